@@ -0,0 +1,55 @@
+package codetags
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+)
+
+//go:embed admin/index.html
+var adminPage []byte
+
+// AdminHandler serves an HTML page to inspect the instances and flip their
+// tags, on top of a DebugHandler whose endpoints are served under api/.
+// Mount it under the prefix given to NewAdminHandler:
+//
+//	http.Handle("/admin/codetags/", codetags.NewAdminHandler("/admin/codetags/", &codetags.DebugHandler{
+//		Authorize: isAdmin,
+//	}))
+//
+// The page posts to the endpoints of the DebugHandler, which refuse the
+// cross-site requests.
+type AdminHandler struct {
+	prefix string
+	debug  *DebugHandler
+}
+
+// NewAdminHandler creates the admin page mounted at prefix for the debug
+// handler, a nil debug handler makes a read-only page.
+func NewAdminHandler(prefix string, debug *DebugHandler) *AdminHandler {
+	if debug == nil {
+		debug = NewDebugHandler()
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &AdminHandler{prefix: prefix, debug: debug}
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, h.prefix+"api/") {
+		h.debug.ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path != h.prefix {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(adminPage)
+}
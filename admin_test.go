@@ -0,0 +1,109 @@
+package codetags
+
+import "encoding/json"
+import "net/http"
+import "net/http/httptest"
+import "os"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func postAdmin(handler http.Handler, action string, body string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/admin/codetags/api/"+action, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Requested-With", "codetags")
+	for k, v := range header {
+		request.Header[k] = v
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminHandler_page(t *testing.T) {
+	handler := NewAdminHandler("/admin/codetags/", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/admin/codetags/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "<title>codetags</title>")
+}
+
+func TestAdminHandler_api(t *testing.T) {
+	os.Setenv("ADMINAPI_EXCLUDED_TAGS", "tag-2")
+
+	ct := newTestInstance(t, "admin-api", &Presets{"namespace": "AdminApi", "version": "1.0.0"})
+	ct.Register([]interface{}{
+		TagDescriptor{Name: "tag-1", Note: "the new checkout"},
+		"tag-2",
+		TagDescriptor{Name: "tag-3", Plan: TagPlan{Enabled: true, MinBound: "2.0.0"}},
+	})
+	debug := &DebugHandler{
+		Authorize: func(r *http.Request) bool {
+			return true
+		},
+	}
+	handler := NewAdminHandler("/admin/codetags", debug)
+
+	recorder := postAdmin(handler, "override", `{"instance":"admin-api","tag":"tag-1","enabled":false}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	state := getDebugState(t, handler, "/admin/codetags/api/state", "ADMIN_API")
+	assert.Equal(t, []TagState{
+		{Name: "tag-1", Active: false, Note: "the new checkout", Sources: []string{"declared", "override-off"}},
+		{Name: "tag-2", Active: false, Sources: []string{"declared", "env-excluded"}},
+		{Name: "tag-3", Active: false, Sources: []string{"filtered"},
+			Plan: &PlanSnapshot{Enabled: Bool(true), MinBound: "2.0.0"}},
+	}, state.Tags)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/admin/codetags/api/history", nil))
+	body := struct {
+		History []ChangeRecord `json:"history"`
+	}{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, 1, len(body.History))
+	assert.Equal(t, "override", body.History[0].Action)
+	assert.Equal(t, "ADMIN_API", body.History[0].Instance)
+	assert.Equal(t, "tag-1", body.History[0].Tag)
+	assert.False(t, *body.History[0].Enabled)
+	assert.Equal(t, debug.History()[0].Time.Unix(), body.History[0].Time.Unix())
+}
+
+func TestAdminHandler_routing(t *testing.T) {
+	handler := NewAdminHandler("/admin/codetags/", nil)
+	for _, target := range []string{"/admin/codetags/other", "/other/api/state", "/admin/codetags/x/api/state"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code, target)
+	}
+}
+
+func TestAdminHandler_crossSite(t *testing.T) {
+	ct := newTestInstance(t, "admin-cross-site")
+	ct.Register([]interface{}{"tag-1"})
+	handler := NewAdminHandler("/admin/codetags/", &DebugHandler{
+		Authorize: func(r *http.Request) bool {
+			return true
+		},
+	})
+	body := `{"instance":"admin-cross-site","tag":"tag-1","enabled":false}`
+
+	recorder := postAdmin(handler, "override", body, http.Header{"X-Requested-With": {""}})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = postAdmin(handler, "override", body, http.Header{"Sec-Fetch-Site": {"cross-site"}})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = postAdmin(handler, "override", body, http.Header{"Origin": {"https://evil.example"}})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = postAdmin(handler, "override", "instance=admin-cross-site&tag=tag-1&enabled=false",
+		http.Header{"Content-Type": {"application/x-www-form-urlencoded"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.True(t, ct.IsActive("tag-1"))
+
+	recorder = postAdmin(handler, "override", body, http.Header{
+		"Sec-Fetch-Site": {"same-origin"},
+		"Origin":         {"http://example.com"},
+	})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, ct.IsActive("tag-1"))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+import "github.com/saolago/codetags"
+
+// diff prints the tags whose state changes between two snapshot files and
+// reports whether there is any change.
+func diff(w io.Writer, format string, args []string) (bool, error) {
+	if len(args) != 2 {
+		return false, fmt.Errorf("Usage: codetags diff old.json new.json")
+	}
+	before, err := readSnapshot(args[0])
+	if err != nil {
+		return false, err
+	}
+	after, err := readSnapshot(args[1])
+	if err != nil {
+		return false, err
+	}
+	changes, err := codetags.Diff(before, after)
+	if err != nil {
+		return false, err
+	}
+	return len(changes) > 0, writeChanges(w, format, changes)
+}
+
+// preview prints the tags that turn on or off when the version preset of the
+// manager, or of the snapshot file if given, is set to the target version.
+func preview(w io.Writer, manager *codetags.TagManager, opts options, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("Usage: codetags preview VERSION [state.json]")
+	}
+	if len(args) == 2 {
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		if err := manager.Import(data); err != nil {
+			return fmt.Errorf("%s: %v", args[1], err)
+		}
+		// the -version flag wins over the version of the snapshot
+		if len(opts.version) > 0 {
+			manager.Initialize(&codetags.Presets{"version": opts.version})
+		}
+	}
+	snapshot := manager.Snapshot()
+	if !hasPlans(snapshot) {
+		// only the plans depend on the version, the tags of -declare have none
+		return fmt.Errorf("No tag plan is loaded, give a state.json written by export")
+	}
+	changes, err := codetags.Diff(snapshot, manager.PreviewVersion(args[0]))
+	if err != nil {
+		return err
+	}
+	return writeChanges(w, opts.format, changes)
+}
+
+func hasPlans(snapshot *codetags.TagSnapshot) bool {
+	for _, descriptor := range snapshot.Descriptors {
+		if descriptor.Plan != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func writeChanges(w io.Writer, format string, changes []codetags.TagChange) error {
+	switch format {
+	case "json":
+		return writeJSON(w, changes)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TAG\tBEFORE\tAFTER\tREASONS")
+		for _, change := range changes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", change.Tag,
+				onOff(change.Before), onOff(change.After), strings.Join(change.Reasons, "; "))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("Unknown format [%s], must be table or json", format)
+}
+
+func readSnapshot(filename string) (*codetags.TagSnapshot, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &codetags.TagSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return snapshot, nil
+}
+
+func onOff(v bool) string {
+	if v {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,265 @@
+// Command codetags prints the effective state of a codetags instance as it
+// would be seen by a process started with the same environment.
+//
+// Usage:
+//
+//	codetags [flags] [show]
+//	codetags [flags] eval 'tag-1 && !tag-2'
+//	codetags [flags] export > state.json
+//	codetags [flags] diff old.json new.json
+//	codetags [flags] preview 2.0.0 [state.json]
+//	codetags prune -tag tag-1 -decision on [-w] [paths...]
+//
+// The diff command exits with 1 when a tag changes and with 2 on error, so it
+// can be used as a CI gate.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+import "github.com/saolago/codetags"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type options struct {
+	name          string
+	namespace     string
+	version       string
+	includedLabel string
+	excludedLabel string
+	declared      string
+	format        string
+	dotenv        string
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	opts := options{}
+	fs := flag.NewFlagSet("codetags", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.name, "name", codetags.DEFAULT_NAMESPACE, "name of the codetags instance")
+	fs.StringVar(&opts.namespace, "namespace", "", "prefix of the environment variables (preset: namespace)")
+	fs.StringVar(&opts.version, "version", "", "version used to evaluate tag plans (preset: version)")
+	fs.StringVar(&opts.includedLabel, "included-label", "", "label of the included tags variable (preset: INCLUDED_TAGS)")
+	fs.StringVar(&opts.excludedLabel, "excluded-label", "", "label of the excluded tags variable (preset: EXCLUDED_TAGS)")
+	fs.StringVar(&opts.declared, "declare", "", "comma-separated list of declared tags")
+	fs.StringVar(&opts.format, "format", "table", "output format: table or json")
+	fs.StringVar(&opts.dotenv, "dotenv", "", "dotenv file read before the environment")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	command := "show"
+	rest := fs.Args()
+	if len(rest) > 0 {
+		command, rest = rest[0], rest[1:]
+	}
+	if command == "prune" {
+		// pruning works on source files, it does not need an instance
+		if err := prune(stdout, stderr, rest); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if command == "diff" {
+		changed, err := diff(stdout, opts.format, rest)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		if changed {
+			return 1
+		}
+		return 0
+	}
+
+	manager, err := loadManager(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	switch command {
+	case "show":
+		err = show(stdout, manager, opts.format)
+	case "eval":
+		err = eval(stdout, manager, opts.format, strings.Join(rest, " "))
+	case "export":
+		err = export(stdout, manager)
+	case "preview":
+		err = preview(stdout, manager, opts, rest)
+	default:
+		err = fmt.Errorf("Unknown command [%s]", command)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func loadManager(opts options) (*codetags.TagManager, error) {
+	presets := codetags.Presets{}
+	for key, val := range map[string]string{
+		"namespace":     opts.namespace,
+		"version":       opts.version,
+		"INCLUDED_TAGS": opts.includedLabel,
+		"EXCLUDED_TAGS": opts.excludedLabel,
+	} {
+		if len(val) > 0 {
+			presets[key] = val
+		}
+	}
+	manager, err := codetags.GetInstance(opts.name)
+	if err != nil {
+		return nil, err
+	}
+	// the default instance is created on package init, start it over
+	manager.Reset().Initialize(&presets)
+	manager.SetEnvLookup(nil)
+	if len(opts.dotenv) > 0 {
+		if err := manager.LoadDotenv(opts.dotenv); err != nil {
+			return nil, err
+		}
+	}
+	declared := []interface{}{}
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(opts.declared, ",") {
+		// Register panics on a tag declared twice
+		if tag = strings.TrimSpace(tag); len(tag) > 0 && !seen[tag] {
+			seen[tag] = true
+			declared = append(declared, tag)
+		}
+	}
+	manager.Register(declared)
+	return manager, nil
+}
+
+type tagState struct {
+	Name     string `json:"name"`
+	Declared bool   `json:"declared"`
+	Included bool   `json:"included"`
+	Excluded bool   `json:"excluded"`
+	Active   bool   `json:"active"`
+}
+
+type managerState struct {
+	Namespace string           `json:"namespace"`
+	Presets   codetags.Presets `json:"presets"`
+	Declared  []string         `json:"declared"`
+	Included  []string         `json:"included"`
+	Excluded  []string         `json:"excluded"`
+	Tags      []tagState       `json:"tags"`
+}
+
+func collectState(manager *codetags.TagManager) managerState {
+	state := managerState{
+		Namespace: codetags.DEFAULT_NAMESPACE,
+		Presets:   manager.GetPresets(),
+		Declared:  manager.GetDeclaredTags(),
+		Included:  manager.GetIncludedTags(),
+		Excluded:  manager.GetExcludedTags(),
+		Tags:      []tagState{},
+	}
+	if namespace, ok := state.Presets["namespace"]; ok && len(namespace) > 0 {
+		state.Namespace = namespace
+	}
+	names := map[string]bool{}
+	for _, list := range [][]string{state.Declared, state.Included, state.Excluded} {
+		for _, tag := range list {
+			names[tag] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for tag := range names {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+	for _, tag := range sorted {
+		state.Tags = append(state.Tags, tagState{
+			Name:     tag,
+			Declared: contains(state.Declared, tag),
+			Included: contains(state.Included, tag),
+			Excluded: contains(state.Excluded, tag),
+			Active:   manager.IsActive(tag),
+		})
+	}
+	return state
+}
+
+func show(w io.Writer, manager *codetags.TagManager, format string) error {
+	state := collectState(manager)
+	switch format {
+	case "json":
+		return writeJSON(w, state)
+	case "table":
+		fmt.Fprintf(w, "namespace: %s\n", state.Namespace)
+		if version, ok := state.Presets["version"]; ok {
+			fmt.Fprintf(w, "version: %s\n", version)
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TAG\tDECLARED\tINCLUDED\tEXCLUDED\tACTIVE")
+		for _, tag := range state.Tags {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", tag.Name,
+				yesNo(tag.Declared), yesNo(tag.Included), yesNo(tag.Excluded), yesNo(tag.Active))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("Unknown format [%s], must be table or json", format)
+}
+
+func eval(w io.Writer, manager *codetags.TagManager, format string, text string) error {
+	exp, err := codetags.ParseExpression(text)
+	if err != nil {
+		return err
+	}
+	active := manager.IsActive(exp)
+	switch format {
+	case "json":
+		return writeJSON(w, map[string]interface{}{"expression": text, "active": active})
+	case "table":
+		fmt.Fprintln(w, active)
+		return nil
+	}
+	return fmt.Errorf("Unknown format [%s], must be table or json", format)
+}
+
+func export(w io.Writer, manager *codetags.TagManager) error {
+	data, err := manager.Export()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+func contains(vs []string, t string) bool {
+	for _, v := range vs {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package main
+
+import "bytes"
+import "encoding/json"
+import "os"
+import "path/filepath"
+import "testing"
+import "github.com/stretchr/testify/assert"
+import "github.com/saolago/codetags"
+
+func TestRun_show(t *testing.T) {
+	os.Setenv("CLISHOW_INCLUDED_TAGS", "tag-3")
+	os.Setenv("CLISHOW_EXCLUDED_TAGS", "tag-2")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{
+		"-name", "cli-show", "-namespace", "CliShow", "-declare", "tag-1,tag-2", "-format", "json",
+	}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+
+	state := managerState{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &state))
+	assert.Equal(t, "CLISHOW", state.Namespace)
+	assert.Equal(t, []tagState{
+		{Name: "tag-1", Declared: true, Active: true},
+		{Name: "tag-2", Declared: true, Excluded: true},
+		{Name: "tag-3", Included: true, Active: true},
+	}, state.Tags)
+}
+
+func TestRun_eval(t *testing.T) {
+	var tableEvalCases = []struct {
+		expression string
+		expected   string
+	}{
+		{expression: "tag-1 && !tag-2", expected: "true\n"},
+		{expression: "tag-1 && tag-2", expected: "false\n"},
+		{expression: "(tag-2 || tag-3) && tag-1", expected: "false\n"},
+	}
+	for i, c := range tableEvalCases {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := run([]string{"-name", "cli-eval", "-namespace", "CliEval", "-declare", "tag-1", "eval", c.expression}, stdout, stderr)
+		if code != 0 {
+			t.Errorf("testcase[%d] - exit code %d: %s", i, code, stderr.String())
+		}
+		if stdout.String() != c.expected {
+			t.Errorf("testcase[%d] - actual[%q] is different with expected [%q]", i, stdout.String(), c.expected)
+		}
+	}
+}
+
+func TestRun_evalInvalidExpression(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-name", "cli-invalid", "eval", "tag-1 &&"}, stdout, stderr)
+	assert.Equal(t, 1, code)
+	assert.NotEmpty(t, stderr.String())
+}
+
+func TestRun_diff(t *testing.T) {
+	os.Setenv("CLIDIFF_EXCLUDED_TAGS", "")
+	dir := t.TempDir()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-name", "cli-diff", "-namespace", "CliDiff", "-declare", "tag-1,tag-2", "export"}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "old.json"), stdout.Bytes(), 0644))
+
+	os.Setenv("CLIDIFF_EXCLUDED_TAGS", "tag-2")
+	stdout.Reset()
+	code = run([]string{"-name", "cli-diff", "-namespace", "CliDiff", "-declare", "tag-1,tag-2", "export"}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "new.json"), stdout.Bytes(), 0644))
+
+	stdout.Reset()
+	code = run([]string{"diff", filepath.Join(dir, "old.json"), filepath.Join(dir, "old.json")}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+
+	stdout.Reset()
+	code = run([]string{"-format", "json", "diff", filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")}, stdout, stderr)
+	assert.Equal(t, 1, code, stderr.String())
+	changes := []codetags.TagChange{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &changes))
+	assert.Equal(t, []codetags.TagChange{
+		{Tag: "tag-2", Before: true, After: false, Reasons: []string{"added to the excluded tags"}},
+	}, changes)
+
+	code = run([]string{"diff", filepath.Join(dir, "missing.json"), filepath.Join(dir, "new.json")}, stdout, stderr)
+	assert.Equal(t, 2, code)
+}
+
+func TestRun_preview(t *testing.T) {
+	state := `{
+  "schemaVersion": 1,
+  "presets": {"namespace": "CLIPREVIEW", "version": "1.0.0"},
+  "descriptors": [
+    {"name": "tag-1"},
+    {"name": "tag-2", "plan": {"enabled": true, "minBound": "2.0.0"}}
+  ],
+  "includedTags": [],
+  "excludedTags": [],
+  "overrides": []
+}`
+	filename := filepath.Join(t.TempDir(), "state.json")
+	assert.Nil(t, os.WriteFile(filename, []byte(state), 0644))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-name", "cli-preview", "preview", "2.0.0", filename}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "TAG    BEFORE  AFTER  REASONS\n"+
+		"tag-2  off     on     plan bound crossed: version 1.0.0 -> 2.0.0\n", stdout.String())
+
+	// the -version flag wins over the version of state.json
+	stdout.Reset()
+	code = run([]string{"-name", "cli-preview", "-version", "2.0.0", "preview", "2.0.0", filename}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "TAG  BEFORE  AFTER  REASONS\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"-name", "cli-preview", "-version", "1.0.0", "-declare", "tag-1", "preview", "2.0.0"}, stdout, stderr)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "No tag plan is loaded, give a state.json written by export\n", stderr.String())
+	assert.Empty(t, stdout.String())
+}
+
+func TestRun_dotenv(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".env")
+	assert.Nil(t, os.WriteFile(filename, []byte("export CLIDOTENV_INCLUDED_TAGS='tag-2'\n"), 0644))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-name", "cli-dotenv", "-namespace", "CliDotenv", "-dotenv", filename, "eval", "tag-2"}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "true\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"-name", "cli-dotenv", "-namespace", "CliDotenv", "eval", "tag-2"}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "false\n", stdout.String())
+}
+
+func TestRun_duplicatedDeclare(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-name", "cli-duplicated", "-namespace", "CliDuplicated", "-declare", "tag-1,tag-1, tag-1", "eval", "tag-1"}, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "true\n", stdout.String())
+}
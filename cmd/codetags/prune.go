@@ -0,0 +1,699 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prune scans Go source files for IsActive calls on a single tag and, given
+// the final decision for that tag, folds the calls into the chosen branch.
+//
+//	codetags prune -tag feature-1 -decision on [-w] [paths...]
+func prune(w io.Writer, stderr io.Writer, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	tag := fs.String("tag", "", "the tag to be removed")
+	decision := fs.String("decision", "", "the final state of the tag: on (always on) or off (always off)")
+	write := fs.Bool("w", false, "write the result to the source files instead of printing a diff")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(*tag) == 0 {
+		return fmt.Errorf("The -tag flag must be not empty")
+	}
+	enabled := false
+	switch *decision {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return fmt.Errorf("Unknown decision [%s], must be on or off", *decision)
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := collectGoFiles(paths)
+	if err != nil {
+		return err
+	}
+	for _, filename := range files {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		result, err := pruneSource(filename, src, *tag, enabled)
+		if err != nil {
+			return err
+		}
+		for _, use := range result.uses {
+			fmt.Fprintln(stderr, use)
+		}
+		if !result.changed {
+			continue
+		}
+		if *write {
+			if err := os.WriteFile(filename, result.output, 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprint(w, unifiedDiff(filename, src, result.output))
+	}
+	return nil
+}
+
+func collectGoFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, root := range paths {
+		recursive := strings.HasSuffix(root, "/...")
+		if recursive {
+			root = strings.TrimSuffix(root, "/...")
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, root)
+			continue
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path == root {
+					return nil
+				}
+				name := info.Name()
+				if !recursive || name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(path, ".go") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+type pruneResult struct {
+	uses    []string
+	output  []byte
+	changed bool
+}
+
+type pruner struct {
+	fset    *token.FileSet
+	file    *token.File
+	src     []byte
+	tag     string
+	enabled bool
+	uses    []string
+	edits   []edit
+	dedents map[int]int
+	handled map[*ast.IfStmt]bool
+	folded  map[*ast.CallExpr]bool
+}
+
+// edit replaces the source bytes in [start, end) by text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// pruneSource folds the IsActive calls of the if-conditions, the other calls
+// are reported as manual. The tag is removed from the Register calls only
+// when no IsActive call mentions it anymore, otherwise these calls would
+// turn off.
+func pruneSource(filename string, src []byte, tag string, enabled bool) (*pruneResult, error) {
+	p, file, err := newPruner(filename, src, tag, enabled)
+	if err != nil {
+		return nil, err
+	}
+	p.collectUses(file)
+	ast.Inspect(file, func(node ast.Node) bool {
+		if n, ok := node.(*ast.IfStmt); ok && !p.handled[n] {
+			p.pruneIf(n)
+		}
+		return true
+	})
+	result := &pruneResult{uses: p.uses, output: src}
+	if len(p.edits) > 0 {
+		if result.output, err = format.Source(p.apply()); err != nil {
+			return nil, err
+		}
+	}
+
+	// the registration is pruned on the folded source
+	p, file, err = newPruner(filename, result.output, tag, enabled)
+	if err != nil {
+		return nil, err
+	}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpr); ok {
+			p.dropFromRegister(call)
+		}
+		return true
+	})
+	if len(p.edits) > 0 {
+		if remaining := p.countUses(file); remaining > 0 {
+			result.uses = append(result.uses, fmt.Sprintf("%s: %q is kept in Register, %d IsActive call(s) must be changed by hand",
+				filename, tag, remaining))
+		} else if result.output, err = format.Source(p.apply()); err != nil {
+			return nil, err
+		}
+	}
+	result.changed = !bytes.Equal(src, result.output)
+	return result, nil
+}
+
+func newPruner(filename string, src []byte, tag string, enabled bool) (*pruner, *ast.File, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &pruner{
+		fset:    fset,
+		file:    fset.File(file.Pos()),
+		src:     src,
+		tag:     tag,
+		enabled: enabled,
+		dedents: map[int]int{},
+		handled: map[*ast.IfStmt]bool{},
+		folded:  map[*ast.CallExpr]bool{},
+	}
+	return p, file, nil
+}
+
+// collectUses reports every IsActive call that mentions the tag, the calls
+// of the if-conditions are foldable, the other ones are left for a human.
+func (p *pruner) collectUses(file *ast.File) {
+	ast.Inspect(file, func(node ast.Node) bool {
+		if ifStmt, ok := node.(*ast.IfStmt); ok {
+			p.markFolded(ifStmt.Cond)
+		}
+		return true
+	})
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || !p.mentions(call) {
+			return true
+		}
+		kind := "manual"
+		if p.folded[call] {
+			kind = "foldable"
+		}
+		p.uses = append(p.uses, fmt.Sprintf("%s: IsActive(%q) [%s]", p.fset.Position(call.Pos()), p.tag, kind))
+		return true
+	})
+}
+
+// countUses counts the IsActive calls that mention the tag.
+func (p *pruner) countUses(file *ast.File) int {
+	count := 0
+	ast.Inspect(file, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpr); ok && p.mentions(call) {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+func (p *pruner) mentions(call *ast.CallExpr) bool {
+	if !isMethodCall(call, "IsActive") {
+		return false
+	}
+	mentioned := false
+	ast.Inspect(call, func(node ast.Node) bool {
+		if isStringLiteral(node, p.tag) {
+			mentioned = true
+		}
+		return !mentioned
+	})
+	return mentioned
+}
+
+// markFolded marks the calls that rewriteCondition folds.
+func (p *pruner) markFolded(exp ast.Expr) {
+	switch e := exp.(type) {
+	case *ast.CallExpr:
+		if isMethodCall(e, "IsActive") && p.foldable(e) {
+			p.folded[e] = true
+		}
+	case *ast.ParenExpr:
+		p.markFolded(e.X)
+	case *ast.UnaryExpr:
+		p.markFolded(e.X)
+	case *ast.BinaryExpr:
+		if e.Op == token.LAND || e.Op == token.LOR {
+			p.markFolded(e.X)
+			p.markFolded(e.Y)
+		}
+	}
+}
+
+// foldable reports whether the tag is passed as a direct argument, only
+// those calls are rewritten; nested expressions are left for a human.
+func (p *pruner) foldable(call *ast.CallExpr) bool {
+	for _, arg := range call.Args {
+		if isStringLiteral(arg, p.tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteCondition replaces the IsActive calls of an if-condition with the
+// decision and simplifies the boolean operators around them.
+func (p *pruner) rewriteCondition(exp ast.Expr) (ast.Expr, bool) {
+	switch e := exp.(type) {
+	case *ast.CallExpr:
+		if !isMethodCall(e, "IsActive") || !p.foldable(e) {
+			return e, false
+		}
+		// the arguments-list of IsActive is an OR of its items
+		if p.enabled {
+			return ast.NewIdent("true"), true
+		}
+		args := []ast.Expr{}
+		for _, arg := range e.Args {
+			if !isStringLiteral(arg, p.tag) {
+				args = append(args, arg)
+			}
+		}
+		if len(args) == 0 {
+			return ast.NewIdent("false"), true
+		}
+		e.Args = args
+		return e, true
+	case *ast.ParenExpr:
+		inner, changed := p.rewriteCondition(e.X)
+		if _, ok := constBool(inner); ok {
+			return inner, changed
+		}
+		e.X = inner
+		return e, changed
+	case *ast.UnaryExpr:
+		inner, changed := p.rewriteCondition(e.X)
+		if val, ok := constBool(inner); ok && e.Op == token.NOT {
+			return ast.NewIdent(strconv.FormatBool(!val)), true
+		}
+		e.X = inner
+		return e, changed
+	case *ast.BinaryExpr:
+		if e.Op != token.LAND && e.Op != token.LOR {
+			return e, false
+		}
+		left, leftChanged := p.rewriteCondition(e.X)
+		right, rightChanged := p.rewriteCondition(e.Y)
+		changed := leftChanged || rightChanged
+		if val, ok := constBool(left); ok {
+			if val == (e.Op == token.LAND) {
+				return right, changed
+			}
+			return left, changed
+		}
+		if val, ok := constBool(right); ok && val == (e.Op == token.LAND) {
+			return left, changed
+		}
+		e.X, e.Y = left, right
+		return e, changed
+	}
+	return exp, false
+}
+
+// resolve walks an if/else-if chain whose leading conditions became constant
+// and returns either the block that always runs or the first if-statement
+// whose condition still has to be evaluated at runtime.
+func (p *pruner) resolve(ifStmt *ast.IfStmt) (*ast.BlockStmt, *ast.IfStmt) {
+	for {
+		p.handled[ifStmt] = true
+		cond, changed := p.rewriteCondition(ifStmt.Cond)
+		val, isConst := constBool(cond)
+		if !isConst {
+			if changed {
+				p.replace(ifStmt.Cond.Pos(), ifStmt.Cond.End(), p.render(cond))
+			}
+			p.resolveElse(ifStmt)
+			return nil, ifStmt
+		}
+		if val {
+			return ifStmt.Body, nil
+		}
+		switch branch := ifStmt.Else.(type) {
+		case *ast.BlockStmt:
+			return branch, nil
+		case *ast.IfStmt:
+			if ifStmt.Init != nil {
+				// the init statement belongs to the whole chain
+				p.replace(ifStmt.Cond.Pos(), ifStmt.Cond.End(), "false")
+				return nil, ifStmt
+			}
+			ifStmt = branch
+		default:
+			return nil, nil
+		}
+	}
+}
+
+// resolveElse simplifies the else-if part of an if-statement that is kept.
+func (p *pruner) resolveElse(parent *ast.IfStmt) {
+	elseIf, ok := parent.Else.(*ast.IfStmt)
+	if !ok || elseIf.Init != nil {
+		return
+	}
+	block, remaining := p.resolve(elseIf)
+	switch {
+	case block != nil:
+		p.replace(elseIf.Pos(), block.Lbrace, "")
+		p.replace(block.End(), elseIf.End(), "")
+	case remaining != nil:
+		p.replace(elseIf.Pos(), remaining.Pos(), "")
+	default:
+		p.replace(parent.Body.End(), elseIf.End(), "")
+	}
+}
+
+// pruneIf collapses an if-statement in statement position into the branch
+// chosen by the decision.
+func (p *pruner) pruneIf(ifStmt *ast.IfStmt) {
+	block, remaining := p.resolve(ifStmt)
+	switch {
+	case remaining != nil:
+		if remaining != ifStmt {
+			p.replace(ifStmt.Pos(), remaining.Pos(), "")
+		}
+	case ifStmt.Init != nil:
+		// keep the scope of the variables declared by the init statement
+		indent := p.indentOf(ifStmt.Pos())
+		init := p.initText(ifStmt.Init, block)
+		if block == nil {
+			p.replace(ifStmt.Pos(), ifStmt.End(), "{\n"+indent+"\t"+init+"\n"+indent+"}")
+			return
+		}
+		p.replace(ifStmt.Pos(), block.Lbrace+1, "{\n"+indent+"\t"+init)
+		p.replace(block.Rbrace, ifStmt.End(), "}")
+	case block == nil:
+		p.replaceLines(ifStmt.Pos(), ifStmt.End())
+	default:
+		p.replaceLines(ifStmt.Pos(), block.Lbrace+1)
+		p.replaceLines(block.Rbrace, ifStmt.End())
+		first := p.file.Line(block.Lbrace) + 1
+		last := p.file.Line(block.Rbrace) - 1
+		for line := first; line <= last; line++ {
+			p.dedents[p.file.Offset(p.file.LineStart(line))]++
+		}
+	}
+}
+
+// dropFromRegister removes the tag from the descriptors list of a Register call.
+func (p *pruner) dropFromRegister(call *ast.CallExpr) {
+	if !isMethodCall(call, "Register") {
+		return
+	}
+	for _, arg := range call.Args {
+		list, ok := arg.(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		for _, elt := range list.Elts {
+			if !isStringLiteral(elt, p.tag) && !isDescriptorOf(elt, p.tag) {
+				continue
+			}
+			end := p.file.Offset(elt.End())
+			if end < len(p.src) && p.src[end] == ',' {
+				end++
+			}
+			p.replaceLines(elt.Pos(), p.file.Pos(end))
+		}
+	}
+}
+
+func (p *pruner) replace(start, end token.Pos, text string) {
+	p.edits = append(p.edits, edit{p.file.Offset(start), p.file.Offset(end), text})
+}
+
+// replaceLines deletes [start, end) together with its lines when nothing
+// else is written on them.
+func (p *pruner) replaceLines(start, end token.Pos) {
+	from, to := p.file.Offset(start), p.file.Offset(end)
+	lineStart := from
+	for lineStart > 0 && (p.src[lineStart-1] == ' ' || p.src[lineStart-1] == '\t') {
+		lineStart--
+	}
+	lineEnd := to
+	for lineEnd < len(p.src) && (p.src[lineEnd] == ' ' || p.src[lineEnd] == '\t') {
+		lineEnd++
+	}
+	if (lineStart == 0 || p.src[lineStart-1] == '\n') && (lineEnd == len(p.src) || p.src[lineEnd] == '\n') {
+		from = lineStart
+		to = lineEnd
+		if to < len(p.src) {
+			to++
+		}
+	}
+	p.edits = append(p.edits, edit{from, to, ""})
+}
+
+// initText renders the init statement of a collapsed if-statement, the
+// variables it declares and the kept block does not use become blanks so
+// the output compiles.
+func (p *pruner) initText(init ast.Stmt, block *ast.BlockStmt) string {
+	assign, ok := init.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE {
+		return p.text(init.Pos(), init.End())
+	}
+	used := map[string]bool{}
+	if block != nil {
+		ast.Inspect(block, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+			return true
+		})
+	}
+	names := []string{}
+	declares := false
+	for _, lhs := range assign.Lhs {
+		name := p.text(lhs.Pos(), lhs.End())
+		if ident, ok := lhs.(*ast.Ident); ok && (ident.Name == "_" || !used[ident.Name]) {
+			name = "_"
+		} else {
+			declares = true
+		}
+		names = append(names, name)
+	}
+	tok := ":="
+	if !declares {
+		tok = "="
+	}
+	return strings.Join(names, ", ") + " " + tok + " " + p.text(assign.Rhs[0].Pos(), assign.Rhs[len(assign.Rhs)-1].End())
+}
+
+func (p *pruner) text(start, end token.Pos) string {
+	return string(p.src[p.file.Offset(start):p.file.Offset(end)])
+}
+
+func (p *pruner) indentOf(pos token.Pos) string {
+	lineStart := p.file.Offset(p.file.LineStart(p.file.Line(pos)))
+	offset := lineStart
+	for offset < len(p.src) && p.src[offset] == '\t' {
+		offset++
+	}
+	return string(p.src[lineStart:offset])
+}
+
+func (p *pruner) render(exp ast.Expr) string {
+	buf := &bytes.Buffer{}
+	format.Node(buf, p.fset, exp)
+	return buf.String()
+}
+
+// apply writes the source with all edits and dedents, the edits nested in a
+// region that has already been replaced are dropped.
+func (p *pruner) apply() []byte {
+	sort.SliceStable(p.edits, func(i, j int) bool {
+		return p.edits[i].start < p.edits[j].start
+	})
+	out := &bytes.Buffer{}
+	next := 0
+	pos := 0
+	for pos < len(p.src) {
+		for next < len(p.edits) && p.edits[next].start < pos {
+			next++
+		}
+		if next < len(p.edits) && p.edits[next].start == pos {
+			out.WriteString(p.edits[next].text)
+			if p.edits[next].end > pos {
+				pos = p.edits[next].end
+			}
+			next++
+			continue
+		}
+		if tabs, ok := p.dedents[pos]; ok {
+			delete(p.dedents, pos)
+			for ; tabs > 0 && pos < len(p.src) && p.src[pos] == '\t'; tabs-- {
+				pos++
+			}
+			continue
+		}
+		out.WriteByte(p.src[pos])
+		pos++
+	}
+	return out.Bytes()
+}
+
+func isMethodCall(call *ast.CallExpr, name string) bool {
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && selector.Sel.Name == name
+}
+
+func isStringLiteral(node ast.Node, value string) bool {
+	lit, ok := node.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return false
+	}
+	unquoted, err := strconv.Unquote(lit.Value)
+	return err == nil && unquoted == value
+}
+
+func isDescriptorOf(exp ast.Expr, tag string) bool {
+	lit, ok := exp.(*ast.CompositeLit)
+	if !ok {
+		return false
+	}
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Name" && isStringLiteral(kv.Value, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func constBool(exp ast.Expr) (bool, bool) {
+	if ident, ok := exp.(*ast.Ident); ok {
+		switch ident.Name {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// unifiedDiff renders the line differences between two versions of a file.
+func unifiedDiff(filename string, a, b []byte) string {
+	x := splitLines(a)
+	y := splitLines(b)
+	// lcs[i][j] is the length of the longest common subsequence of x[i:], y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	type line struct {
+		op   byte
+		text string
+		i, j int
+	}
+	lines := []line{}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i], i, j})
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, line{'+', y[j], i, j})
+			j++
+		default:
+			lines = append(lines, line{'-', x[i], i, j})
+			i++
+		}
+	}
+	const context = 3
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", filename, filename)
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+		// extend the hunk while the changes are close to each other
+		end := start
+		for k := start; k < len(lines); k++ {
+			if lines[k].op != ' ' {
+				end = k + 1
+			} else if k-end >= 2*context {
+				break
+			}
+		}
+		from := start - context
+		if from < 0 {
+			from = 0
+		}
+		to := end + context
+		if to > len(lines) {
+			to = len(lines)
+		}
+		countA, countB := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				countA++
+			}
+			if l.op != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", lines[from].i+1, countA, lines[from].j+1, countB)
+		for _, l := range lines[from:to] {
+			fmt.Fprintf(out, "%c%s\n", l.op, l.text)
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func splitLines(src []byte) []string {
+	text := strings.TrimSuffix(string(src), "\n")
+	if len(text) == 0 {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,209 @@
+package main
+
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+const pruneSample = `package sample
+
+func run(mgr *codetags.TagManager) {
+	mgr.Register([]interface{}{
+		"feature-1",
+		"feature-2",
+		codetags.TagDescriptor{Name: "feature-1"},
+	})
+	if mgr.IsActive("feature-1") {
+		newFlow()
+	} else {
+		oldFlow()
+	}
+	if !mgr.IsActive("feature-1") && ready() {
+		legacy()
+	}
+	if mgr.IsActive("feature-2", "feature-1") {
+		either()
+	}
+	enabled := mgr.IsActive([]interface{}{"feature-1", "feature-2"})
+	_ = enabled
+}
+`
+
+func TestPruneSource_alwaysOn(t *testing.T) {
+	result, err := pruneSource("sample.go", []byte(pruneSample), "feature-1", true)
+	assert.Nil(t, err)
+	assert.True(t, result.changed)
+	assert.Equal(t, `package sample
+
+func run(mgr *codetags.TagManager) {
+	mgr.Register([]interface{}{
+		"feature-1",
+		"feature-2",
+		codetags.TagDescriptor{Name: "feature-1"},
+	})
+	newFlow()
+	either()
+	enabled := mgr.IsActive([]interface{}{"feature-1", "feature-2"})
+	_ = enabled
+}
+`, string(result.output))
+	// the manual call keeps the tag registered, it would turn off otherwise
+	assert.Equal(t, 5, len(result.uses))
+	assert.True(t, strings.HasSuffix(result.uses[3], "[manual]"))
+	assert.Equal(t, `sample.go: "feature-1" is kept in Register, 1 IsActive call(s) must be changed by hand`, result.uses[4])
+}
+
+func TestPruneSource_alwaysOff(t *testing.T) {
+	result, err := pruneSource("sample.go", []byte(pruneSample), "feature-1", false)
+	assert.Nil(t, err)
+	assert.Equal(t, `package sample
+
+func run(mgr *codetags.TagManager) {
+	mgr.Register([]interface{}{
+		"feature-1",
+		"feature-2",
+		codetags.TagDescriptor{Name: "feature-1"},
+	})
+	oldFlow()
+	if ready() {
+		legacy()
+	}
+	if mgr.IsActive("feature-2") {
+		either()
+	}
+	enabled := mgr.IsActive([]interface{}{"feature-1", "feature-2"})
+	_ = enabled
+}
+`, string(result.output))
+}
+
+func TestPruneSource_unused(t *testing.T) {
+	result, err := pruneSource("sample.go", []byte(pruneSample), "feature-9", true)
+	assert.Nil(t, err)
+	assert.False(t, result.changed)
+	assert.Empty(t, result.uses)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	diff := unifiedDiff("a.go", []byte("a\nb\nc\n"), []byte("a\nc\nd\n"))
+	assert.Equal(t, "--- a.go\n+++ a.go\n@@ -1,3 +1,3 @@\n a\n-b\n c\n+d\n", diff)
+}
+
+func TestPruneSource_elseIfChain(t *testing.T) {
+	src := `package sample
+
+func run(mgr *codetags.TagManager) {
+	if ready() {
+		prepare()
+	} else if mgr.IsActive("feature-1") {
+		// the new flow
+		newFlow()
+	} else {
+		oldFlow()
+	}
+	if v := load(); mgr.IsActive("feature-1") {
+		use(v)
+	}
+}
+`
+	result, err := pruneSource("sample.go", []byte(src), "feature-1", true)
+	assert.Nil(t, err)
+	assert.Equal(t, `package sample
+
+func run(mgr *codetags.TagManager) {
+	if ready() {
+		prepare()
+	} else {
+		// the new flow
+		newFlow()
+	}
+	{
+		v := load()
+		use(v)
+	}
+}
+`, string(result.output))
+}
+
+func TestPruneSource_register(t *testing.T) {
+	src := `package sample
+
+func run(mgr *codetags.TagManager) {
+	mgr.Register([]interface{}{"feature-1", "feature-2"})
+	if mgr.IsActive("feature-1") {
+		newFlow()
+	}
+}
+`
+	result, err := pruneSource("sample.go", []byte(src), "feature-1", true)
+	assert.Nil(t, err)
+	assert.Equal(t, `package sample
+
+func run(mgr *codetags.TagManager) {
+	mgr.Register([]interface{}{"feature-2"})
+	newFlow()
+}
+`, string(result.output))
+}
+
+func TestPruneSource_manual(t *testing.T) {
+	src := `package sample
+
+func run(mgr *codetags.TagManager) {
+	mgr.Register([]interface{}{"feature-1"})
+	ok := mgr.IsActive("feature-1")
+	for mgr.IsActive("feature-1") {
+		wait()
+	}
+	use(ok)
+}
+`
+	result, err := pruneSource("sample.go", []byte(src), "feature-1", true)
+	assert.Nil(t, err)
+	assert.False(t, result.changed)
+	assert.Equal(t, 3, len(result.uses))
+	assert.True(t, strings.HasSuffix(result.uses[0], "[manual]"))
+	assert.True(t, strings.HasSuffix(result.uses[1], "[manual]"))
+}
+
+func TestPruneSource_unusedInit(t *testing.T) {
+	src := `package sample
+
+func run(mgr *codetags.TagManager) {
+	if v := load(); mgr.IsActive("feature-1") {
+		use(v)
+	} else {
+		other()
+	}
+	if v, err := load2(); mgr.IsActive("feature-1") {
+		use(v)
+	} else {
+		check(err)
+	}
+	if v := load(); mgr.IsActive("feature-1") {
+		use(v)
+	} else if ready() {
+		other()
+	}
+}
+`
+	result, err := pruneSource("sample.go", []byte(src), "feature-1", false)
+	assert.Nil(t, err)
+	assert.Equal(t, `package sample
+
+func run(mgr *codetags.TagManager) {
+	{
+		_ = load()
+		other()
+	}
+	{
+		_, err := load2()
+		check(err)
+	}
+	if v := load(); false {
+		use(v)
+	} else if ready() {
+		other()
+	}
+}
+`, string(result.output))
+}
@@ -5,10 +5,12 @@ package codetags
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 )
 import "github.com/blang/semver"
 
@@ -31,79 +33,95 @@ type TagPlan struct {
 type Presets = map[string]string
 
 type TagManager struct {
+	mu    sync.Mutex
 	store struct {
 		env          map[string][]string
 		declaredTags []string
 		includedTags []string
 		excludedTags []string
 		cachedTags   map[string]bool
-	}
-	presets Presets
+		variants     map[string]VariantDescriptor
+		variantPicks map[string]string
+		experiments  map[string]Experiment
+		usage        map[string]*tagUsage
+		usagePeriod  uint64
+		descriptors  []TagDescriptor
+		overrides    map[string]*override
+		pinnedEnv    map[string][]string
+		flagTags     map[string]bool
+	}
+	presets       Presets
+	onAssignment  func(Assignment)
+	metrics       *Metrics
+	logger        *slog.Logger
+	logEvents     []logEvent
+	overrideStore OverrideStore
+	saver         overrideSaver
+	parent        *TagManager
+	lockedTags    map[string]bool
+	remote        *remoteLayer
+	watchers      []*func()
+	lookupEnv     func(key string) (string, bool)
 }
 
 func (c *TagManager) Initialize(opts *Presets) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.initialize(opts)
+}
+
+func (c *TagManager) initialize(opts *Presets) *TagManager {
 	if opts != nil {
-		for _, key := range []string{"version"} {
+		for _, key := range []string{"version", "stateFile", "parent", "dotenv"} {
 			if val, ok := (*opts)[key]; ok {
-				c.presets[key] = val
+				c.setPreset(key, val)
 			}
 		}
 		for _, key := range []string{"namespace", "INCLUDED_TAGS", "EXCLUDED_TAGS"} {
 			if val, ok := (*opts)[key]; ok {
-				c.presets[key] = labelify(val)
+				c.setPreset(key, labelify(val))
 			}
 		}
 	}
 	return c.refreshEnv()
 }
 
+func (c *TagManager) setPreset(key string, val string) {
+	if old, ok := c.presets[key]; !ok || old != val {
+		c.log("codetags: preset changed", "key", key, "old", old, "new", val)
+	}
+	c.presets[key] = val
+}
+
 var nameOfTagDescriptor string = typeof(TagDescriptor{})
 var nameOfTagPlan string = typeof(TagPlan{})
 
 // Register is used to declare the pre-defined tags
 func (c *TagManager) Register(descriptors []interface{}) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	if errs := c.register(descriptors); len(errs) > 0 {
+		panic(strings.Join(errs, "\n"))
+	}
+	return c
+}
+
+func (c *TagManager) register(descriptors []interface{}) []string {
 	errs := []string{}
 	defs := listFilter(descriptors, func(descriptor interface{}, idx int) bool {
 		descriptorType := typeof(descriptor)
 		if descriptorType == "string" {
+			c.store.descriptors = append(c.store.descriptors, TagDescriptor{Name: descriptor.(string)})
 			return true
 		}
 		if descriptorType == nameOfTagDescriptor {
 			info := descriptor.(TagDescriptor)
-			if info.Plan != nil && typeof(info.Plan) == nameOfTagPlan {
-				plan := info.Plan.(TagPlan)
-				if plan.Enabled != nil && typeof(plan.Enabled) == "bool" {
-					if versionStr, ok := c.presets["version"]; ok {
-						validated := true
-						satisfied := true
-						version, versionErr := semver.Make(versionStr)
-						validated = validated && (versionErr == nil)
-						if plan.MinBound != nil && typeof(plan.MinBound) == "string" {
-							minBound, minBoundErr := semver.Make(plan.MinBound.(string))
-							validated = validated && (minBoundErr == nil)
-							satisfied = satisfied && (version.Compare(minBound) >= 0)
-						}
-						if plan.MaxBound != nil && typeof(plan.MaxBound) == "string" {
-							maxBound, maxBoundErr := semver.Make(plan.MaxBound.(string))
-							validated = validated && (maxBoundErr == nil)
-							satisfied = satisfied && (version.Compare(maxBound) < 0)
-						}
-						if validated {
-							if satisfied {
-								return plan.Enabled.(bool)
-							}
-							if info.Enabled != nil && typeof(info.Enabled) == "bool" {
-								return info.Enabled.(bool)
-							}
-							return !plan.Enabled.(bool)
-						}
-					}
-				}
-			}
-			if info.Enabled != nil && typeof(info.Enabled) == "bool" {
-				return info.Enabled.(bool)
+			c.store.descriptors = append(c.store.descriptors, info)
+			enabled, reason := isDescriptorEnabled(info, c.presets)
+			if !enabled {
+				c.log("codetags: descriptor filtered out", "tag", info.Name, "reason", reason)
 			}
-			return true
+			return enabled
 		}
 		errs = append(errs, fmt.Sprintf(
 			"descriptor#%d [%v] has invalid type (%s), must be a string or TagDescriptor type",
@@ -118,20 +136,62 @@ func (c *TagManager) Register(descriptors []interface{}) *TagManager {
 		}
 		return info.(string)
 	})
+	declared := []string{}
 	for _, tag := range tags {
 		if !listContains(c.store.declaredTags, tag) {
 			c.store.declaredTags = append(c.store.declaredTags, tag)
+			declared = append(declared, tag)
 		} else {
 			errs = append(errs, fmt.Sprintf("Tag [%s] is declared more than one time", tag))
 		}
 	}
-	if len(errs) > 0 {
-		panic(strings.Join(errs, "\n"))
+	c.log("codetags: tags registered", "declared", declared, "errors", errs)
+	c.changed()
+	return errs
+}
+
+// isDescriptorEnabled evaluates the Enabled flag and the TagPlan of a
+// descriptor against the version preset, the reason explains a disabled one.
+func isDescriptorEnabled(info TagDescriptor, presets Presets) (bool, string) {
+	if info.Plan != nil && typeof(info.Plan) == nameOfTagPlan {
+		plan := info.Plan.(TagPlan)
+		if plan.Enabled != nil && typeof(plan.Enabled) == "bool" {
+			if versionStr, ok := presets["version"]; ok {
+				validated := true
+				satisfied := true
+				version, versionErr := semver.Make(versionStr)
+				validated = validated && (versionErr == nil)
+				if plan.MinBound != nil && typeof(plan.MinBound) == "string" {
+					minBound, minBoundErr := semver.Make(plan.MinBound.(string))
+					validated = validated && (minBoundErr == nil)
+					satisfied = satisfied && (version.Compare(minBound) >= 0)
+				}
+				if plan.MaxBound != nil && typeof(plan.MaxBound) == "string" {
+					maxBound, maxBoundErr := semver.Make(plan.MaxBound.(string))
+					validated = validated && (maxBoundErr == nil)
+					satisfied = satisfied && (version.Compare(maxBound) < 0)
+				}
+				if validated {
+					if satisfied {
+						return plan.Enabled.(bool), fmt.Sprintf("plan is disabled for version %s", versionStr)
+					}
+					if info.Enabled != nil && typeof(info.Enabled) == "bool" {
+						return info.Enabled.(bool), fmt.Sprintf("version %s is out of the plan bounds and the tag is disabled", versionStr)
+					}
+					return !plan.Enabled.(bool), fmt.Sprintf("version %s is out of the bounds of an enabled plan", versionStr)
+				}
+			}
+		}
 	}
-	return c
+	if info.Enabled != nil && typeof(info.Enabled) == "bool" {
+		return info.Enabled.(bool), "tag is disabled"
+	}
+	return true, ""
 }
 
 func (c *TagManager) IsActive(tagexps ...interface{}) bool {
+	c.mu.Lock()
+	defer c.unlock()
 	return c.isArgumentsSatisfied(tagexps)
 }
 
@@ -206,6 +266,9 @@ func (c *TagManager) evaluateExpression(tagexp interface{}) bool {
 	if tagexp == nil {
 		return false
 	}
+	if e, ok := tagexp.(Expr); ok {
+		return c.eval(e)
+	}
 	expType := reflect.TypeOf(tagexp)
 	expTypeKind := expType.Kind().String()
 	// type: string
@@ -248,36 +311,92 @@ func (c *TagManager) evaluateExpression(tagexp interface{}) bool {
 }
 
 func (c *TagManager) checkLabelActivated(label string) bool {
-	if cachedVal, ok := c.store.cachedTags[label]; ok {
-		return cachedVal
+	cachedVal, ok := c.store.cachedTags[label]
+	if !ok {
+		var cacheable bool
+		cachedVal, cacheable = c.resolveLabel(label)
+		if cacheable {
+			c.store.cachedTags[label] = cachedVal
+		}
+	} else if c.parent != nil && c.parent.isLockedOff(label) {
+		cachedVal = false
 	}
-	c.store.cachedTags[label] = c.forceCheckLabelActivated(label)
-	return c.store.cachedTags[label]
+	c.recordUsage(label, cachedVal)
+	if c.metrics != nil {
+		c.metrics.observe(c.getLabel("namespace"), label, cachedVal)
+	}
+	return cachedVal
 }
 
 func (c *TagManager) forceCheckLabelActivated(label string) bool {
+	active, _ := c.resolveLabel(label)
+	return active
+}
+
+// resolveLabel evaluates a tag, the result is not cacheable when it comes
+// from the parent because the parent can change on its own.
+func (c *TagManager) resolveLabel(label string) (bool, bool) {
+	if c.parent != nil && c.parent.isLockedOff(label) {
+		return false, false
+	}
+	if active, ok := c.ownLabelState(label); ok {
+		return active, true
+	}
+	if c.parent != nil {
+		return c.parent.inheritedState(label), false
+	}
+	return false, true
+}
+
+// ownLabelState evaluates a tag with the overrides, the command-line flags,
+// the remote layer, the excluded, included and declared tags of the manager,
+// ok is false when none of them decides.
+func (c *TagManager) ownLabelState(label string) (active bool, ok bool) {
+	if o, ok := c.store.overrides[label]; ok {
+		return o.Enabled, true
+	}
+	if enabled, ok := c.store.flagTags[label]; ok {
+		return enabled, true
+	}
+	if active, ok := c.remoteLabelState(label); ok {
+		return active, true
+	}
 	if listContains(c.store.excludedTags, label) {
-		return false
+		return false, true
 	}
 	if listContains(c.store.includedTags, label) {
-		return true
+		return true, true
+	}
+	if listContains(c.store.declaredTags, label) {
+		return true, true
 	}
-	return listContains(c.store.declaredTags, label)
+	if c.remote != nil && listContains(c.remote.declaredTags, label) {
+		return true, true
+	}
+	return false, false
 }
 
 func (c *TagManager) GetDeclaredTags() []string {
+	c.mu.Lock()
+	defer c.unlock()
 	return listClone(c.store.declaredTags)
 }
 
 func (c *TagManager) GetExcludedTags() []string {
+	c.mu.Lock()
+	defer c.unlock()
 	return listClone(c.store.excludedTags)
 }
 
 func (c *TagManager) GetIncludedTags() []string {
+	c.mu.Lock()
+	defer c.unlock()
 	return listClone(c.store.includedTags)
 }
 
 func (c *TagManager) GetPresets() Presets {
+	c.mu.Lock()
+	defer c.unlock()
 	cloned := Presets{}
 	for k, v := range c.presets {
 		cloned[k] = v
@@ -286,8 +405,34 @@ func (c *TagManager) GetPresets() Presets {
 }
 
 func (c *TagManager) Reset() *TagManager {
-	c.ClearCache()
+	c.mu.Lock()
+	defer c.unlock()
+	return c.reset()
+}
+
+func (c *TagManager) reset() *TagManager {
+	c.log("codetags: reset", "declared", c.store.declaredTags)
+	c.clearCache()
 	c.store.declaredTags = c.store.declaredTags[:0]
+	for k := range c.store.variants {
+		delete(c.store.variants, k)
+	}
+	for k := range c.store.experiments {
+		delete(c.store.experiments, k)
+	}
+	for k := range c.store.usage {
+		delete(c.store.usage, k)
+	}
+	c.store.descriptors = c.store.descriptors[:0]
+	for k := range c.store.pinnedEnv {
+		delete(c.store.pinnedEnv, k)
+	}
+	// the overrides are not saved, the store is detached like the presets
+	c.overrideStore = nil
+	for k, o := range c.store.overrides {
+		o.stop()
+		delete(c.store.overrides, k)
+	}
 	for k := range c.presets {
 		delete(c.presets, k)
 	}
@@ -295,6 +440,12 @@ func (c *TagManager) Reset() *TagManager {
 }
 
 func (c *TagManager) ClearCache() *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.clearCache()
+}
+
+func (c *TagManager) clearCache() *TagManager {
 	for k := range c.store.cachedTags {
 		delete(c.store.cachedTags, k)
 	}
@@ -305,19 +456,86 @@ func (c *TagManager) refreshEnv() *TagManager {
 	for k := range c.store.env {
 		delete(c.store.env, k)
 	}
+	excludedTags, includedTags := c.store.excludedTags, c.store.includedTags
 	c.store.excludedTags = c.getEnv(c.getLabel("excludedTags"))
 	c.store.includedTags = c.getEnv(c.getLabel("includedTags"))
+	changes := [][]string{
+		listDifference(c.store.includedTags, includedTags),
+		listDifference(includedTags, c.store.includedTags),
+		listDifference(c.store.excludedTags, excludedTags),
+		listDifference(excludedTags, c.store.excludedTags),
+	}
+	// ClearCache refreshes the environment on every call, only a change is
+	// worth an event
+	if len(changes[0])+len(changes[1])+len(changes[2])+len(changes[3]) > 0 {
+		c.log("codetags: environment refreshed",
+			"included_added", changes[0], "included_removed", changes[1],
+			"excluded_added", changes[2], "excluded_removed", changes[3])
+	}
+	c.store.variantPicks = parseVariantPicks(c.getEnv(c.getLabel("variants")))
+	c.changed()
 	return c
 }
 
+// watch registers fn to be called after each change of the presets, the
+// environment, the declared tags or the overrides. fn is called with the
+// lock of the manager held, it must not call the manager. The returned
+// function removes it.
+func (c *TagManager) watch(fn func()) func() {
+	c.mu.Lock()
+	defer c.unlock()
+	watcher := &fn
+	c.watchers = append(c.watchers, watcher)
+	return func() {
+		c.mu.Lock()
+		defer c.unlock()
+		for i, w := range c.watchers {
+			if w == watcher {
+				c.watchers = append(c.watchers[:i:i], c.watchers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (c *TagManager) changed() {
+	for _, fn := range c.watchers {
+		(*fn)()
+	}
+}
+
 func (c *TagManager) getEnv(label string) []string {
 	if tags, ok := c.store.env[label]; ok {
 		return tags
 	}
-	c.store.env[label] = stringToList(os.Getenv(label))
+	if tags, ok := c.store.pinnedEnv[label]; ok {
+		c.store.env[label] = listClone(tags)
+		return c.store.env[label]
+	}
+	c.store.env[label] = stringToList(c.lookup(label))
 	return c.store.env[label]
 }
 
+// lookup reads an environment variable with the lookup of SetEnvLookup.
+func (c *TagManager) lookup(label string) string {
+	lookup := c.lookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	value, _ := lookup(label)
+	return value
+}
+
+// SetEnvLookup replaces os.LookupEnv as the source of the environment
+// variables, a nil lookup restores it. The environment is read again.
+func (c *TagManager) SetEnvLookup(lookup func(key string) (string, bool)) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	c.lookupEnv = lookup
+	c.clearCache()
+	return c
+}
+
 func (c *TagManager) getLabel(keyword string) string {
 	label := ""
 	if namespace, ok := c.presets["namespace"]; ok && len(namespace) > 0 {
@@ -352,8 +570,6 @@ func (c *TagManager) getLabel(keyword string) string {
 	return label
 }
 
-var instances map[string]*TagManager = make(map[string]*TagManager)
-
 var instance *TagManager = Default()
 
 func Default() *TagManager {
@@ -362,46 +578,49 @@ func Default() *TagManager {
 }
 
 func GetInstance(name string, opts ...*Presets) (*TagManager, error) {
-	name = labelify(name)
-	if instance, ok := instances[name]; ok {
-		return instance, nil
-	}
-	if len(opts) > 0 {
-		return createInstance(name, opts[0])
-	}
-	return createInstance(name, nil)
+	return defaultRegistry.Get(name, opts...)
 }
 
 func NewInstance(name string, opts ...*Presets) (*TagManager, error) {
-	name = labelify(name)
-	if name == DEFAULT_NAMESPACE {
-		if _, ok := instances[name]; ok {
-			return nil, fmt.Errorf(
-				"%s is default instance name. Please provides another name.",
-				DEFAULT_NAMESPACE)
-		}
-	}
-	if len(opts) > 0 {
-		return createInstance(name, opts[0])
-	}
-	return createInstance(name, nil)
+	return defaultRegistry.New(name, opts...)
 }
 
-func createInstance(name string, opts *Presets) (*TagManager, error) {
-	if name == "" {
-		return nil, fmt.Errorf(
-			"The name of a codetags instance must be not empty")
-	}
+// ReplaceInstance creates the instance with the name, replacing the existing
+// one. The default instance cannot be replaced.
+func ReplaceInstance(name string, opts ...*Presets) (*TagManager, error) {
+	return defaultRegistry.Replace(name, opts...)
+}
+
+// RemoveInstance deletes the instance with the name, it returns false when
+// there is no such instance or for the default instance.
+func RemoveInstance(name string) bool {
+	return defaultRegistry.Remove(name)
+}
+
+// ListInstances returns the sorted names of the instances.
+func ListInstances() []string {
+	return defaultRegistry.List()
+}
+
+// newTagManager creates a manager which is not registered as an instance.
+func newTagManager() *TagManager {
 	c := &TagManager{}
 	c.store.env = make(map[string][]string, 0)
 	c.store.declaredTags = make([]string, 0)
 	c.store.excludedTags = make([]string, 0)
 	c.store.includedTags = make([]string, 0)
 	c.store.cachedTags = make(map[string]bool, 0)
+	c.store.variants = make(map[string]VariantDescriptor, 0)
+	c.store.variantPicks = make(map[string]string, 0)
+	c.store.experiments = make(map[string]Experiment, 0)
+	c.store.usage = make(map[string]*tagUsage, 0)
+	c.store.descriptors = make([]TagDescriptor, 0)
+	c.store.overrides = make(map[string]*override, 0)
+	c.lockedTags = make(map[string]bool, 0)
+	c.store.pinnedEnv = make(map[string][]string, 0)
+	c.store.flagTags = make(map[string]bool, 0)
 	c.presets = make(Presets)
-	c.Initialize(opts)
-	instances[name] = c
-	return instances[name], nil
+	return c
 }
 
 var nonWords = regexp.MustCompile(`\W{1,}`)
@@ -427,6 +646,16 @@ func listContains(vs []string, t string) bool {
 	return listIndex(vs, t) >= 0
 }
 
+func listDifference(vs []string, ts []string) []string {
+	diff := make([]string, 0)
+	for _, v := range vs {
+		if !listContains(ts, v) {
+			diff = append(diff, v)
+		}
+	}
+	return diff
+}
+
 func listFilter(vs []interface{}, f func(interface{}, int) bool) []interface{} {
 	vsf := make([]interface{}, 0)
 	for i, v := range vs {
@@ -35,6 +35,45 @@ func TestNewInstance_illegal_name(t *testing.T) {
 	}
 }
 
+func TestNewInstance_existing_name(t *testing.T) {
+	first, err := NewInstance("existing-name")
+	assert.Nil(t, err)
+	_, err = NewInstance("Existing Name")
+	assert.EqualError(t, err, "Instance [EXISTING_NAME] already exists")
+
+	second, err := ReplaceInstance("existing-name")
+	assert.Nil(t, err)
+	assert.False(t, first == second)
+	assert.Equal(t, second, getFirstReturn(GetInstance("existing-name")))
+	assert.Contains(t, ListInstances(), "EXISTING_NAME")
+
+	assert.True(t, RemoveInstance("existing-name"))
+	assert.False(t, RemoveInstance("existing-name"))
+	assert.NotContains(t, ListInstances(), "EXISTING_NAME")
+
+	_, err = ReplaceInstance("CodeTags")
+	assert.EqualError(t, err, "CODETAGS is default instance name. Please provides another name.")
+	assert.False(t, RemoveInstance(DEFAULT_NAMESPACE))
+	assert.Equal(t, Default(), instance)
+}
+
+func TestSetEnvLookup(t *testing.T) {
+	os.Setenv("ENVLOOKUP_INCLUDED_TAGS", "tag-1")
+
+	ct := newTestInstance(t, "env-lookup", &Presets{"namespace": "EnvLookup"})
+	assert.True(t, ct.IsActive("tag-1"))
+	ct.SetEnvLookup(func(key string) (string, bool) {
+		if key == "ENVLOOKUP_INCLUDED_TAGS" {
+			return "tag-2", true
+		}
+		return "", false
+	})
+	assert.False(t, ct.IsActive("tag-1"))
+	assert.True(t, ct.IsActive("tag-2"))
+	ct.SetEnvLookup(nil)
+	assert.True(t, ct.IsActive("tag-1"))
+}
+
 func TestInitialize(t *testing.T) {
 	var tableInitializeCases = []struct {
 		current  *Presets
@@ -48,7 +87,7 @@ func TestInitialize(t *testing.T) {
 		},
 	}
 	for i, c := range tableInitializeCases {
-		ct, _ := NewInstance("test", c.current)
+		ct, _ := ReplaceInstance("test", c.current)
 		ctRef := ct.Initialize(c.data)
 		if ctRef != ct {
 			t.Errorf("testcase[%d] - output Ref is different with source Ref", i)
@@ -89,7 +128,7 @@ func TestRegister(t *testing.T) {
 		},
 	}
 	for i, c := range tableRegisterCases {
-		ct, _ := NewInstance("test", c.presets)
+		ct, _ := ReplaceInstance("test", c.presets)
 		ctRef := ct.Register(c.descriptors)
 		if ctRef != ct {
 			t.Errorf("testcase[%d] - output Ref is different with source Ref", i)
@@ -105,7 +144,7 @@ func TestIsActive(t *testing.T) {
 	os.Setenv("ISACTIVE_INCLUDED_TAGS", "abc, def, xyz, tag-4")
 	os.Setenv("ISACTIVE_EXCLUDED_TAGS", "disabled, tag-2")
 
-	isacti, _ := NewInstance("isacti", &Presets{
+	isacti := newTestInstance(t, "isacti", &Presets{
 		"namespace": "IsActive",
 	})
 
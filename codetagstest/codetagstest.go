@@ -0,0 +1,87 @@
+// Package codetagstest provides helpers to test code depending on codetags
+// without touching the environment of the process or the global instances.
+package codetagstest
+
+import "testing"
+import "github.com/saolago/codetags"
+
+// New creates a manager in a registry of its own, the environment variables
+// are empty for it. The manager is reset when the test ends.
+func New(t testing.TB, opts *codetags.Presets) *codetags.TagManager {
+	t.Helper()
+	c, err := codetags.NewRegistry().New(t.Name(), opts)
+	if err != nil {
+		t.Fatalf("codetagstest: %v", err)
+	}
+	c.SetEnvLookup(func(key string) (string, bool) {
+		return "", false
+	})
+	t.Cleanup(func() {
+		c.Reset()
+	})
+	return c
+}
+
+// SetTags turns the tags on or off with overrides of the manager, the
+// previous overrides of these tags are restored when the test ends.
+func SetTags(t testing.TB, c *codetags.TagManager, tags map[string]bool) {
+	t.Helper()
+	previous := map[string]codetags.OverrideRecord{}
+	for _, record := range c.OverrideRecords() {
+		previous[record.Tag] = record
+	}
+	for tag, enabled := range tags {
+		c.Override(tag, enabled)
+	}
+	t.Cleanup(func() {
+		for tag := range tags {
+			if record, ok := previous[tag]; ok {
+				c.ApplyOverride(record)
+			} else {
+				c.RemoveOverride(tag)
+			}
+		}
+	})
+}
+
+// AssertActive reports an error for each tag which is not active.
+func AssertActive(t testing.TB, c *codetags.TagManager, tags ...string) bool {
+	t.Helper()
+	ok := true
+	for _, tag := range tags {
+		if !c.IsActive(tag) {
+			t.Errorf("codetagstest: tag [%s] must be active", tag)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertInactive reports an error for each tag which is active.
+func AssertInactive(t testing.TB, c *codetags.TagManager, tags ...string) bool {
+	t.Helper()
+	ok := true
+	for _, tag := range tags {
+		if c.IsActive(tag) {
+			t.Errorf("codetagstest: tag [%s] must be inactive", tag)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertExpression reports an error when the expression, as accepted by
+// codetags.ParseExpression, does not evaluate to expected.
+func AssertExpression(t testing.TB, c *codetags.TagManager, expression string, expected bool) bool {
+	t.Helper()
+	exp, err := codetags.ParseExpression(expression)
+	if err != nil {
+		t.Errorf("codetagstest: %v", err)
+		return false
+	}
+	if actual := c.IsActive(exp); actual != expected {
+		t.Errorf("codetagstest: expression [%s] is %v, must be %v", expression, actual, expected)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package codetagstest
+
+import "fmt"
+import "os"
+import "testing"
+import "github.com/stretchr/testify/assert"
+import "github.com/saolago/codetags"
+
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestNew(t *testing.T) {
+	os.Setenv("CODETAGSTEST_EXCLUDED_TAGS", "tag-1")
+
+	c := New(t, &codetags.Presets{"namespace": "CodetagsTest"})
+	c.Register([]interface{}{"tag-1"})
+	assert.True(t, c.IsActive("tag-1"))
+	assert.NotContains(t, codetags.ListInstances(), "TESTNEW")
+}
+
+func TestSetTags(t *testing.T) {
+	c := New(t, nil)
+	c.Register([]interface{}{"tag-1", "tag-2"})
+	c.Override("tag-2", false)
+
+	t.Run("overridden", func(t *testing.T) {
+		SetTags(t, c, map[string]bool{"tag-1": false, "tag-2": true, "tag-3": true})
+		AssertInactive(t, c, "tag-1")
+		AssertActive(t, c, "tag-2", "tag-3")
+		AssertExpression(t, c, "tag-2 && !tag-1", true)
+	})
+
+	AssertActive(t, c, "tag-1")
+	AssertInactive(t, c, "tag-2", "tag-3")
+	assert.Equal(t, map[string]bool{"tag-2": false}, c.Overrides())
+}
+
+func TestAssert_failures(t *testing.T) {
+	c := New(t, nil)
+	c.Register([]interface{}{"tag-1"})
+
+	r := &recorder{TB: t}
+	assert.False(t, AssertActive(r, c, "tag-1", "tag-2"))
+	assert.False(t, AssertInactive(r, c, "tag-1"))
+	assert.False(t, AssertExpression(r, c, "tag-1 && tag-2", true))
+	assert.False(t, AssertExpression(r, c, "tag-1 &&", true))
+	assert.Equal(t, 4, len(r.errors))
+	assert.Equal(t, "codetagstest: tag [tag-2] must be active", r.errors[0])
+}
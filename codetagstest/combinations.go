@@ -0,0 +1,145 @@
+package codetagstest
+
+import "strings"
+import "testing"
+import "github.com/saolago/codetags"
+
+// RunCombinations runs fn in a subtest for every on/off combination of the
+// tags, 2^len(tags) subtests. Each subtest gets a fresh manager created by
+// New with the tags set by SetTags, it is named after the combination like
+// "tag-1=on,tag-2=off".
+func RunCombinations(t *testing.T, opts *codetags.Presets, tags []string, fn func(t *testing.T, c *codetags.TagManager)) {
+	t.Helper()
+	run(t, opts, tags, Combinations(tags), fn)
+}
+
+// RunPairwise is RunCombinations over the reduced set of Pairwise, for the
+// sets of tags which are too large to run every combination.
+func RunPairwise(t *testing.T, opts *codetags.Presets, tags []string, fn func(t *testing.T, c *codetags.TagManager)) {
+	t.Helper()
+	run(t, opts, tags, Pairwise(tags), fn)
+}
+
+func run(t *testing.T, opts *codetags.Presets, tags []string, combinations []map[string]bool, fn func(t *testing.T, c *codetags.TagManager)) {
+	t.Helper()
+	for _, states := range combinations {
+		states := states
+		t.Run(CombinationName(tags, states), func(t *testing.T) {
+			c := New(t, opts)
+			SetTags(t, c, states)
+			fn(t, c)
+		})
+	}
+}
+
+// CombinationName names the states of the tags in the order of the tags.
+func CombinationName(tags []string, states map[string]bool) string {
+	parts := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if states[tag] {
+			parts = append(parts, tag+"=on")
+		} else {
+			parts = append(parts, tag+"=off")
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Combinations returns every on/off combination of the tags, all the tags
+// off first.
+func Combinations(tags []string) []map[string]bool {
+	combinations := []map[string]bool{}
+	for bits := 0; bits < 1<<uint(len(tags)); bits++ {
+		states := make(map[string]bool, len(tags))
+		for i, tag := range tags {
+			states[tag] = bits&(1<<uint(len(tags)-1-i)) != 0
+		}
+		combinations = append(combinations, states)
+	}
+	return combinations
+}
+
+type statePair struct {
+	i, j   int
+	vi, vj bool
+}
+
+// Pairwise returns combinations of the tags in which every pair of tags
+// takes its four pairs of states at least once. The combinations are built
+// greedily, their number grows slowly with the number of tags.
+func Pairwise(tags []string) []map[string]bool {
+	n := len(tags)
+	if n < 3 {
+		return Combinations(tags)
+	}
+	values := []bool{false, true}
+	uncovered := map[statePair]bool{}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			for _, vi := range values {
+				for _, vj := range values {
+					uncovered[statePair{i, j, vi, vj}] = true
+				}
+			}
+		}
+	}
+	combinations := []map[string]bool{}
+	for len(uncovered) > 0 {
+		seed := firstUncovered(n, uncovered)
+		row := make([]bool, n)
+		assigned := make([]bool, n)
+		row[seed.i], row[seed.j] = seed.vi, seed.vj
+		assigned[seed.i], assigned[seed.j] = true, true
+		for k := 0; k < n; k++ {
+			if assigned[k] {
+				continue
+			}
+			best, bestScore := false, -1
+			for _, v := range values {
+				score := 0
+				for m := 0; m < n; m++ {
+					if assigned[m] && uncovered[orderedPair(m, k, row[m], v)] {
+						score++
+					}
+				}
+				if score > bestScore {
+					best, bestScore = v, score
+				}
+			}
+			row[k], assigned[k] = best, true
+		}
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				delete(uncovered, statePair{i, j, row[i], row[j]})
+			}
+		}
+		states := make(map[string]bool, n)
+		for i, tag := range tags {
+			states[tag] = row[i]
+		}
+		combinations = append(combinations, states)
+	}
+	return combinations
+}
+
+func firstUncovered(n int, uncovered map[statePair]bool) statePair {
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			for _, vi := range []bool{false, true} {
+				for _, vj := range []bool{false, true} {
+					if p := (statePair{i, j, vi, vj}); uncovered[p] {
+						return p
+					}
+				}
+			}
+		}
+	}
+	return statePair{}
+}
+
+func orderedPair(a, b int, va, vb bool) statePair {
+	if a < b {
+		return statePair{a, b, va, vb}
+	}
+	return statePair{b, a, vb, va}
+}
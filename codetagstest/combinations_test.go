@@ -0,0 +1,61 @@
+package codetagstest
+
+import "fmt"
+import "testing"
+import "github.com/stretchr/testify/assert"
+import "github.com/saolago/codetags"
+
+func TestCombinations(t *testing.T) {
+	assert.Equal(t, []map[string]bool{
+		{"tag-1": false, "tag-2": false},
+		{"tag-1": false, "tag-2": true},
+		{"tag-1": true, "tag-2": false},
+		{"tag-1": true, "tag-2": true},
+	}, Combinations([]string{"tag-1", "tag-2"}))
+	assert.Equal(t, []map[string]bool{{}}, Combinations(nil))
+}
+
+func TestPairwise(t *testing.T) {
+	for _, n := range []int{3, 4, 10, 30} {
+		tags := []string{}
+		for i := 0; i < n; i++ {
+			tags = append(tags, fmt.Sprintf("tag-%d", i))
+		}
+		combinations := Pairwise(tags)
+		assert.True(t, len(combinations) < 1<<uint(n), "n=%d", n)
+		assert.True(t, len(combinations) <= 4*n, "n=%d", n)
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				covered := map[[2]bool]bool{}
+				for _, states := range combinations {
+					covered[[2]bool{states[tags[i]], states[tags[j]]}] = true
+				}
+				assert.Equal(t, 4, len(covered), "n=%d, pair %s %s", n, tags[i], tags[j])
+			}
+		}
+	}
+}
+
+func TestRunCombinations(t *testing.T) {
+	names := []string{}
+	RunCombinations(t, &codetags.Presets{"namespace": "Combinations"}, []string{"tag-1", "tag-2"}, func(t *testing.T, c *codetags.TagManager) {
+		names = append(names, t.Name())
+		// the code under test must be safe whatever the states are
+		if c.IsActive("tag-2") {
+			assert.True(t, c.IsActive([]interface{}{"tag-2"}))
+		}
+		assert.Equal(t, 2, len(c.Overrides()))
+	})
+	assert.Equal(t, []string{
+		"TestRunCombinations/tag-1=off,tag-2=off",
+		"TestRunCombinations/tag-1=off,tag-2=on",
+		"TestRunCombinations/tag-1=on,tag-2=off",
+		"TestRunCombinations/tag-1=on,tag-2=on",
+	}, names)
+
+	count := 0
+	RunPairwise(t, nil, []string{"a", "b", "c", "d", "e", "f"}, func(t *testing.T, c *codetags.TagManager) {
+		count++
+	})
+	assert.True(t, count < 64)
+}
@@ -0,0 +1,414 @@
+package codetags
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DebugHandler serves the state of every codetags instance as JSON, like
+// expvar does for variables. Mount it under a prefix of your choice:
+//
+//	http.Handle("/debug/codetags/", codetags.NewDebugHandler())
+//
+// GET .../history returns the changes made through the handler, GET on any
+// other path returns the state. When Authorize is set, the POST endpoints
+// are available to the authorized requests:
+//
+//	POST .../override         {"instance":<name>,"tag":<tag>,"enabled":<bool>[,"ttl":<duration>][,"reason":<text>]}
+//	POST .../remove-override  {"instance":<name>,"tag":<tag>}
+//	POST .../clear-cache      {"instance":<name>} (all instances when empty)
+//
+// The POST endpoints take a JSON object and require the X-Requested-With
+// header. Cross-site requests are refused, a browser cannot send them
+// without the consent of the page, so Authorize may rely on cookies.
+//
+// Identify, when set, names the author of the overrides. Registry selects
+// the served instances, nil serves the instances of GetInstance.
+type DebugHandler struct {
+	Authorize func(r *http.Request) bool
+	Identify  func(r *http.Request) string
+	Registry  *Registry
+
+	mu      sync.Mutex
+	history []ChangeRecord
+}
+
+// ChangeRecord describes a change made through the DebugHandler.
+type ChangeRecord struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Instance string    `json:"instance"`
+	Tag      string    `json:"tag,omitempty"`
+	Enabled  *bool     `json:"enabled,omitempty"`
+	TTL      string    `json:"ttl,omitempty"`
+	Remote   string    `json:"remote"`
+}
+
+// maxChangeRecords is the number of changes kept by a DebugHandler.
+const maxChangeRecords = 100
+
+// NewDebugHandler creates a read-only debug handler.
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{}
+}
+
+// InstanceState is the JSON representation of a codetags instance.
+type InstanceState struct {
+	Name            string           `json:"name"`
+	Namespace       string           `json:"namespace"`
+	Presets         Presets          `json:"presets"`
+	DeclaredTags    []string         `json:"declaredTags"`
+	IncludedTags    []string         `json:"includedTags"`
+	ExcludedTags    []string         `json:"excludedTags"`
+	CachedTags      map[string]bool  `json:"cachedTags"`
+	Overrides       map[string]bool  `json:"overrides"`
+	OverrideRecords []OverrideRecord `json:"overrideRecords"`
+	Tags            []TagState       `json:"tags"`
+}
+
+// TagState describes a known tag of an instance: its descriptor and where
+// its current state comes from.
+type TagState struct {
+	Name    string        `json:"name"`
+	Active  bool          `json:"active"`
+	Note    string        `json:"note,omitempty"`
+	Enabled *bool         `json:"enabled,omitempty"`
+	Plan    *PlanSnapshot `json:"plan,omitempty"`
+	Sources []string      `json:"sources"`
+}
+
+func (c *TagManager) getState(name string) InstanceState {
+	c.mu.Lock()
+	defer c.unlock()
+	state := InstanceState{
+		Name:         name,
+		Namespace:    c.getLabel("namespace"),
+		Presets:      Presets{},
+		DeclaredTags: listClone(c.store.declaredTags),
+		IncludedTags: listClone(c.store.includedTags),
+		ExcludedTags: listClone(c.store.excludedTags),
+		CachedTags:   make(map[string]bool, len(c.store.cachedTags)),
+		Overrides:    make(map[string]bool, len(c.store.overrides)),
+	}
+	for k, v := range c.presets {
+		state.Presets[k] = v
+	}
+	for k, v := range c.store.cachedTags {
+		state.CachedTags[k] = v
+	}
+	for k, o := range c.store.overrides {
+		state.Overrides[k] = o.Enabled
+	}
+	state.OverrideRecords = c.getOverrideRecords()
+	state.Tags = c.getTagStates()
+	return state
+}
+
+// getTagStates lists the registered, included and excluded tags with the
+// sources of their states: declared, filtered (by the descriptor or its
+// plan), flag-on, flag-off, remote-declared, remote-included,
+// remote-excluded, remote-override-on, remote-override-off, env-included,
+// env-excluded, override-on and override-off.
+func (c *TagManager) getTagStates() []TagState {
+	tags := []TagState{}
+	indexes := map[string]int{}
+	addSource := func(tag string, source string) {
+		idx, ok := indexes[tag]
+		if !ok {
+			idx = len(tags)
+			indexes[tag] = idx
+			tags = append(tags, TagState{Name: tag, Active: c.forceCheckLabelActivated(tag), Sources: []string{}})
+		}
+		tags[idx].Sources = append(tags[idx].Sources, source)
+	}
+	for _, info := range c.store.descriptors {
+		if _, ok := indexes[info.Name]; ok {
+			continue
+		}
+		if listContains(c.store.declaredTags, info.Name) {
+			addSource(info.Name, "declared")
+		} else {
+			addSource(info.Name, "filtered")
+		}
+		state, descriptor := &tags[indexes[info.Name]], newDescriptorSnapshot(info)
+		state.Note, state.Enabled, state.Plan = descriptor.Note, descriptor.Enabled, descriptor.Plan
+	}
+	flagged := make([]string, 0, len(c.store.flagTags))
+	for tag := range c.store.flagTags {
+		flagged = append(flagged, tag)
+	}
+	sort.Strings(flagged)
+	for _, tag := range flagged {
+		if c.store.flagTags[tag] {
+			addSource(tag, "flag-on")
+		} else {
+			addSource(tag, "flag-off")
+		}
+	}
+	if c.remote != nil {
+		for _, tag := range c.remote.declaredTags {
+			addSource(tag, "remote-declared")
+		}
+		for _, tag := range c.remote.includedTags {
+			addSource(tag, "remote-included")
+		}
+		for _, tag := range c.remote.excludedTags {
+			addSource(tag, "remote-excluded")
+		}
+		remote := make([]string, 0, len(c.remote.overrides))
+		for tag := range c.remote.overrides {
+			remote = append(remote, tag)
+		}
+		sort.Strings(remote)
+		for _, tag := range remote {
+			if c.remote.overrides[tag].Enabled {
+				addSource(tag, "remote-override-on")
+			} else {
+				addSource(tag, "remote-override-off")
+			}
+		}
+	}
+	for _, tag := range c.store.includedTags {
+		addSource(tag, "env-included")
+	}
+	for _, tag := range c.store.excludedTags {
+		addSource(tag, "env-excluded")
+	}
+	overridden := make([]string, 0, len(c.store.overrides))
+	for tag := range c.store.overrides {
+		overridden = append(overridden, tag)
+	}
+	sort.Strings(overridden)
+	for _, tag := range overridden {
+		if c.store.overrides[tag].Enabled {
+			addSource(tag, "override-on")
+		} else {
+			addSource(tag, "override-off")
+		}
+	}
+	return tags
+}
+
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if path.Base(r.URL.Path) == "history" {
+			h.serveHistory(w)
+			return
+		}
+		h.serveState(w)
+	case http.MethodPost:
+		if h.Authorize == nil || !h.Authorize(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err := checkDebugRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		form, err := readDebugForm(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.Form, r.PostForm = form, form
+		switch path.Base(r.URL.Path) {
+		case "override":
+			err = h.override(r)
+		case "remove-override":
+			err = h.removeOverride(r)
+		case "clear-cache":
+			err = h.clearCache(r)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.serveState(w)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *DebugHandler) serveState(w http.ResponseWriter) {
+	registry := h.registry()
+	names := registry.List()
+	states := make([]InstanceState, 0, len(names))
+	for _, name := range names {
+		if c, ok := registry.lookup(name); ok {
+			states = append(states, c.getState(name))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(map[string]interface{}{"instances": states})
+}
+
+func (h *DebugHandler) serveHistory(w http.ResponseWriter) {
+	history := h.History()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(map[string]interface{}{"history": history})
+}
+
+// History returns the changes made through the handler, the oldest first.
+func (h *DebugHandler) History() []ChangeRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history := make([]ChangeRecord, len(h.history))
+	copy(history, h.history)
+	return history
+}
+
+func (h *DebugHandler) record(r *http.Request, change ChangeRecord) {
+	change.Time = time.Now()
+	change.Remote = r.RemoteAddr
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = append(h.history, change)
+	if len(h.history) > maxChangeRecords {
+		h.history = h.history[len(h.history)-maxChangeRecords:]
+	}
+}
+
+func (h *DebugHandler) registry() *Registry {
+	if h.Registry != nil {
+		return h.Registry
+	}
+	return defaultRegistry
+}
+
+func (h *DebugHandler) lookupInstance(name string) (*TagManager, error) {
+	if c, ok := h.registry().lookup(name); ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("Instance [%s] is not found", name)
+}
+
+func (h *DebugHandler) override(r *http.Request) error {
+	c, err := h.lookupInstance(r.FormValue("instance"))
+	if err != nil {
+		return err
+	}
+	tag := r.FormValue("tag")
+	if len(tag) == 0 {
+		return fmt.Errorf("The tag must be not empty")
+	}
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		return fmt.Errorf("The enabled value [%s] is not a boolean", r.FormValue("enabled"))
+	}
+	change := ChangeRecord{Action: "override", Instance: labelify(r.FormValue("instance")), Tag: tag, Enabled: &enabled}
+	record := OverrideRecord{Tag: tag, Enabled: enabled, Reason: r.FormValue("reason"), CreatedAt: time.Now()}
+	if h.Identify != nil {
+		record.Author = h.Identify(r)
+	}
+	if ttlStr := r.FormValue("ttl"); len(ttlStr) > 0 {
+		ttl, err := time.ParseDuration(ttlStr)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("The ttl value [%s] is not a positive duration", ttlStr)
+		}
+		change.TTL = ttl.String()
+		record.ExpiresAt = record.CreatedAt.Add(ttl)
+	}
+	// the override is applied even when the store fails to save it
+	err = c.ApplyOverride(record)
+	h.record(r, change)
+	if err != nil {
+		return fmt.Errorf("The override is applied but not saved: %v", err)
+	}
+	return nil
+}
+
+func (h *DebugHandler) removeOverride(r *http.Request) error {
+	c, err := h.lookupInstance(r.FormValue("instance"))
+	if err != nil {
+		return err
+	}
+	tag := r.FormValue("tag")
+	if len(tag) == 0 {
+		return fmt.Errorf("The tag must be not empty")
+	}
+	c.RemoveOverride(tag)
+	h.record(r, ChangeRecord{Action: "remove-override", Instance: labelify(r.FormValue("instance")), Tag: tag})
+	return nil
+}
+
+func (h *DebugHandler) clearCache(r *http.Request) error {
+	name := r.FormValue("instance")
+	if len(name) == 0 {
+		registry := h.registry()
+		for _, name := range registry.List() {
+			if c, ok := registry.lookup(name); ok {
+				c.ClearCache()
+			}
+		}
+		h.record(r, ChangeRecord{Action: "clear-cache"})
+		return nil
+	}
+	c, err := h.lookupInstance(name)
+	if err != nil {
+		return err
+	}
+	c.ClearCache()
+	h.record(r, ChangeRecord{Action: "clear-cache", Instance: labelify(name)})
+	return nil
+}
+
+// checkDebugRequest refuses the POST requests which may come from another
+// site: a custom header is required, and the Sec-Fetch-Site and Origin
+// headers must be same-origin when the browser sends them.
+func checkDebugRequest(r *http.Request) error {
+	if len(r.Header.Get("X-Requested-With")) == 0 {
+		return fmt.Errorf("The X-Requested-With header is required")
+	}
+	if site := r.Header.Get("Sec-Fetch-Site"); len(site) > 0 && site != "same-origin" && site != "none" {
+		return fmt.Errorf("Cross-site requests are not allowed")
+	}
+	if origin := r.Header.Get("Origin"); len(origin) > 0 {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return fmt.Errorf("Cross-origin requests are not allowed")
+		}
+	}
+	return nil
+}
+
+// readDebugForm decodes the JSON object of a POST request into form values.
+func readDebugForm(r *http.Request) (url.Values, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return nil, fmt.Errorf("The request body must be application/json")
+	}
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("The request body is not a JSON object: %v", err)
+	}
+	form := url.Values{}
+	for k, v := range body {
+		switch v := v.(type) {
+		case string:
+			form.Set(k, v)
+		case bool, float64:
+			form.Set(k, fmt.Sprint(v))
+		default:
+			return nil, fmt.Errorf("The value of [%s] must be a string, a number or a boolean", k)
+		}
+	}
+	return form, nil
+}
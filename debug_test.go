@@ -0,0 +1,172 @@
+package codetags
+
+import "encoding/json"
+import "net/http"
+import "net/http/httptest"
+import "net/url"
+import "os"
+import "strconv"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func getDebugState(t *testing.T, handler http.Handler, target string, name string) InstanceState {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := struct {
+		Instances []InstanceState `json:"instances"`
+	}{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	for _, state := range body.Instances {
+		if state.Name == name {
+			return state
+		}
+	}
+	t.Fatalf("instance [%s] is not served", name)
+	return InstanceState{}
+}
+
+func postDebug(handler http.Handler, action string, form url.Values) *httptest.ResponseRecorder {
+	values := map[string]string{}
+	for k := range form {
+		values[k] = form.Get(k)
+	}
+	body, _ := json.Marshal(values)
+	request := httptest.NewRequest("POST", "/debug/codetags/"+action, strings.NewReader(string(body)))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Requested-With", "codetags")
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestDebugHandler_state(t *testing.T) {
+	os.Setenv("DEBUGSTATE_INCLUDED_TAGS", "abc")
+
+	ct := newTestInstance(t, "debug-state", &Presets{"namespace": "DebugState"})
+	ct.Register([]interface{}{"tag-1"})
+	ct.IsActive("tag-1", "tag-2")
+
+	state := getDebugState(t, NewDebugHandler(), "/debug/codetags/", "DEBUG_STATE")
+	assert.Equal(t, "DEBUGSTATE", state.Namespace)
+	assert.Equal(t, Presets{"namespace": "DEBUGSTATE"}, state.Presets)
+	assert.Equal(t, []string{"tag-1"}, state.DeclaredTags)
+	assert.Equal(t, []string{"abc"}, state.IncludedTags)
+	assert.Equal(t, []string{}, state.ExcludedTags)
+	assert.Equal(t, map[string]bool{"tag-1": true}, state.CachedTags)
+}
+
+func TestDebugHandler_readOnly(t *testing.T) {
+	newTestInstance(t, "debug-read-only")
+	recorder := postDebug(NewDebugHandler(), "clear-cache", url.Values{"instance": {"debug-read-only"}})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestDebugHandler_override(t *testing.T) {
+	ct := newTestInstance(t, "debug-override")
+	ct.Register([]interface{}{"tag-1"})
+	handler := &DebugHandler{
+		Authorize: func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer secret"
+		},
+		Identify: func(r *http.Request) string {
+			return "ops"
+		},
+	}
+
+	assert.True(t, ct.IsActive("tag-1"))
+	recorder := postDebug(handler, "override", url.Values{"instance": {"debug-override"}, "tag": {"tag-1"}, "enabled": {"false"}})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, ct.IsActive("tag-1"))
+
+	recorder = postDebug(handler, "override", url.Values{"instance": {"debug-override"}, "tag": {"tag-2"}, "enabled": {"true"}, "reason": {"canary"}})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, ct.IsActive("tag-2"))
+	assert.Equal(t, "ops", ct.OverrideRecords()[1].Author)
+	assert.Equal(t, "canary", ct.OverrideRecords()[1].Reason)
+
+	// the overrides survive a reload of the environment
+	recorder = postDebug(handler, "clear-cache", url.Values{"instance": {"debug-override"}})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, ct.IsActive("tag-1"))
+	assert.True(t, ct.IsActive("tag-2"))
+
+	recorder = postDebug(handler, "remove-override", url.Values{"instance": {"debug-override"}, "tag": {"tag-1"}})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, ct.IsActive("tag-1"))
+	assert.Equal(t, map[string]bool{"tag-2": true}, ct.Overrides())
+
+	recorder = postDebug(handler, "override", url.Values{"instance": {"debug-override"}, "tag": {"tag-2"}, "enabled": {"false"}, "ttl": {"1h"}})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, ct.IsActive("tag-2"))
+	assert.Equal(t, "1h0m0s", handler.History()[4].TTL)
+
+	recorder = postDebug(handler, "override", url.Values{"instance": {"unknown"}, "tag": {"tag-1"}, "enabled": {"true"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = postDebug(handler, "override", url.Values{"instance": {"debug-override"}, "tag": {"tag-1"}, "enabled": {"maybe"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = postDebug(handler, "override", url.Values{"instance": {"debug-override"}, "tag": {"tag-1"}, "enabled": {"true"}, "ttl": {"-1s"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestDebugHandler_crossSite(t *testing.T) {
+	ct := newTestInstance(t, "debug-cross-site")
+	ct.Register([]interface{}{"tag-1"})
+	// a cookie is sent by the browser along with a cross-site form
+	handler := &DebugHandler{
+		Authorize: func(r *http.Request) bool {
+			cookie, err := r.Cookie("session")
+			return err == nil && cookie.Value == "admin"
+		},
+	}
+	post := func(body string, header http.Header) int {
+		request := httptest.NewRequest("POST", "/debug/codetags/override", strings.NewReader(body))
+		request.AddCookie(&http.Cookie{Name: "session", Value: "admin"})
+		for k, v := range header {
+			request.Header[k] = v
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	body := `{"instance":"debug-cross-site","tag":"tag-1","enabled":false}`
+
+	assert.Equal(t, http.StatusForbidden, post("instance=debug-cross-site&tag=tag-1&enabled=false",
+		http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}))
+	assert.Equal(t, http.StatusBadRequest, post("instance=debug-cross-site&tag=tag-1&enabled=false",
+		http.Header{"Content-Type": {"application/x-www-form-urlencoded"}, "X-Requested-With": {"codetags"}}))
+	assert.Equal(t, http.StatusForbidden, post(body, http.Header{
+		"Content-Type":     {"application/json"},
+		"X-Requested-With": {"codetags"},
+		"Sec-Fetch-Site":   {"cross-site"},
+	}))
+	assert.True(t, ct.IsActive("tag-1"))
+
+	assert.Equal(t, http.StatusOK, post(body, http.Header{
+		"Content-Type":     {"application/json"},
+		"X-Requested-With": {"codetags"},
+	}))
+	assert.False(t, ct.IsActive("tag-1"))
+}
+
+func TestDebugHandler_concurrentInstances(t *testing.T) {
+	registry := NewRegistry()
+	handler := &DebugHandler{Registry: registry}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_, err := registry.New("debug-concurrent-" + strconv.Itoa(i))
+			assert.Nil(t, err)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/codetags/", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+	<-done
+	assert.Equal(t, 50, len(registry.List()))
+}
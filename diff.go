@@ -0,0 +1,136 @@
+package codetags
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TagChange is a tag whose effective state differs between two snapshots,
+// the reasons explain what caused the difference.
+type TagChange struct {
+	Tag     string   `json:"tag"`
+	Before  bool     `json:"before"`
+	After   bool     `json:"after"`
+	Reasons []string `json:"reasons"`
+}
+
+// Diff lists the tags whose effective state changes from the snapshot a to
+// the snapshot b. The snapshots are evaluated by managers which are not
+// registered as instances, the environment of the process is ignored.
+func Diff(a, b *TagSnapshot) ([]TagChange, error) {
+	before, names, err := evaluateSnapshot(a)
+	if err != nil {
+		return nil, err
+	}
+	after, added, err := evaluateSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range added {
+		if _, ok := before[tag]; !ok {
+			names = append(names, tag)
+		}
+	}
+	changes := []TagChange{}
+	for _, tag := range names {
+		if before[tag] != after[tag] {
+			changes = append(changes, TagChange{
+				Tag:     tag,
+				Before:  before[tag],
+				After:   after[tag],
+				Reasons: diffReasons(tag, a, b),
+			})
+		}
+	}
+	return changes, nil
+}
+
+// evaluateSnapshot returns the effective states of the tags known by the
+// snapshot and their names in the order of the debug states.
+func evaluateSnapshot(snapshot *TagSnapshot) (map[string]bool, []string, error) {
+	c := newTagManager()
+	if err := c.Restore(snapshot); err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	// stops the timers of the overrides
+	defer c.reset()
+	states := map[string]bool{}
+	names := []string{}
+	for _, state := range c.getTagStates() {
+		states[state.Name] = state.Active
+		names = append(names, state.Name)
+	}
+	return states, names, nil
+}
+
+func diffReasons(tag string, a, b *TagSnapshot) []string {
+	reasons := []string{}
+	descA, okA := a.descriptor(tag)
+	descB, okB := b.descriptor(tag)
+	switch {
+	case !okA && okB:
+		reasons = append(reasons, "descriptor added")
+	case okA && !okB:
+		reasons = append(reasons, "descriptor removed")
+	case okA && okB && !reflect.DeepEqual(descA, descB):
+		reasons = append(reasons, "descriptor changed")
+	case okA && okB && descA.Plan != nil:
+		enabledA, _ := isDescriptorEnabled(descA.toTagDescriptor(), a.Presets)
+		enabledB, _ := isDescriptorEnabled(descB.toTagDescriptor(), b.Presets)
+		if enabledA != enabledB {
+			reasons = append(reasons, fmt.Sprintf("plan bound crossed: version %s -> %s",
+				a.Presets["version"], b.Presets["version"]))
+		}
+	}
+	reasons = append(reasons, listChangeReasons(tag, a.IncludedTags, b.IncludedTags, "included tags")...)
+	reasons = append(reasons, listChangeReasons(tag, a.ExcludedTags, b.ExcludedTags, "excluded tags")...)
+	overrideA, okA := a.override(tag)
+	overrideB, okB := b.override(tag)
+	switch {
+	case !okA && okB:
+		reasons = append(reasons, fmt.Sprintf("override added (%s)", onOff(overrideB.Enabled)))
+	case okA && !okB:
+		reasons = append(reasons, "override removed")
+	case okA && okB && overrideA.Enabled != overrideB.Enabled:
+		reasons = append(reasons, fmt.Sprintf("override changed to %s", onOff(overrideB.Enabled)))
+	}
+	return reasons
+}
+
+func listChangeReasons(tag string, before, after []string, name string) []string {
+	inBefore, inAfter := listContains(before, tag), listContains(after, tag)
+	if !inBefore && inAfter {
+		return []string{"added to the " + name}
+	}
+	if inBefore && !inAfter {
+		return []string{"removed from the " + name}
+	}
+	return nil
+}
+
+func (s *TagSnapshot) descriptor(name string) (DescriptorSnapshot, bool) {
+	for _, descriptor := range s.Descriptors {
+		if descriptor.Name == name {
+			return descriptor, true
+		}
+	}
+	return DescriptorSnapshot{}, false
+}
+
+func (s *TagSnapshot) override(tag string) (OverrideRecord, bool) {
+	for _, record := range s.Overrides {
+		if record.Tag == tag {
+			return record, true
+		}
+	}
+	return OverrideRecord{}, false
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,56 @@
+package codetags
+
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func TestDiff(t *testing.T) {
+	before := &TagSnapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Presets:       Presets{"namespace": "DIFF", "version": "1.0.0"},
+		Descriptors: []DescriptorSnapshot{
+			{Name: "tag-1"},
+			{Name: "tag-2", Plan: &PlanSnapshot{Enabled: Bool(true), MinBound: "2.0.0"}},
+			{Name: "tag-3"},
+			{Name: "tag-4"},
+			{Name: "tag-5"},
+		},
+		IncludedTags: []string{"abc"},
+		ExcludedTags: []string{},
+		Overrides:    []OverrideRecord{{Tag: "tag-5", Enabled: false}},
+	}
+	after := &TagSnapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Presets:       Presets{"namespace": "DIFF", "version": "2.0.0"},
+		Descriptors: []DescriptorSnapshot{
+			{Name: "tag-1"},
+			{Name: "tag-2", Plan: &PlanSnapshot{Enabled: Bool(true), MinBound: "2.0.0"}},
+			{Name: "tag-4", Enabled: Bool(false)},
+			{Name: "tag-5"},
+			{Name: "tag-6"},
+		},
+		IncludedTags: []string{},
+		ExcludedTags: []string{"tag-1"},
+		Overrides:    []OverrideRecord{{Tag: "xyz", Enabled: true, ExpiresAt: time.Now().Add(time.Hour)}},
+	}
+
+	changes, err := Diff(before, after)
+	assert.Nil(t, err)
+	assert.Equal(t, []TagChange{
+		{Tag: "tag-1", Before: true, After: false, Reasons: []string{"added to the excluded tags"}},
+		{Tag: "tag-2", Before: false, After: true, Reasons: []string{"plan bound crossed: version 1.0.0 -> 2.0.0"}},
+		{Tag: "tag-3", Before: true, After: false, Reasons: []string{"descriptor removed"}},
+		{Tag: "tag-4", Before: true, After: false, Reasons: []string{"descriptor changed"}},
+		{Tag: "tag-5", Before: false, After: true, Reasons: []string{"override removed"}},
+		{Tag: "abc", Before: true, After: false, Reasons: []string{"removed from the included tags"}},
+		{Tag: "tag-6", Before: false, After: true, Reasons: []string{"descriptor added"}},
+		{Tag: "xyz", Before: false, After: true, Reasons: []string{"override added (on)"}},
+	}, changes)
+
+	changes, err = Diff(after, after)
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+
+	_, err = Diff(before, &TagSnapshot{})
+	assert.NotNil(t, err)
+}
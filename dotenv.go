@@ -0,0 +1,130 @@
+package codetags
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var dotenvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ParseDotenv reads KEY=VALUE lines in the dotenv format: blank lines and
+// lines starting with # are skipped, a line may start with "export ", a
+// value may be single-quoted (literal), double-quoted (with the \n, \t, \"
+// and \\ escapes) or bare, a bare value ends at " #".
+func ParseDotenv(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimSpace(line[len("export"):])
+		}
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("Line %d of the dotenv file must be KEY=VALUE", lineNo)
+		}
+		key := strings.TrimSpace(line[:idx])
+		if !dotenvKey.MatchString(key) {
+			return nil, fmt.Errorf("Line %d of the dotenv file has an invalid key [%s]", lineNo, key)
+		}
+		value, err := parseDotenvValue(strings.TrimSpace(line[idx+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("Line %d of the dotenv file %v", lineNo, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func parseDotenvValue(raw string) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	switch raw[0] {
+	case '\'':
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("has an unterminated quote")
+		}
+		return raw[1 : end+1], checkDotenvRest(raw[end+2:])
+	case '"':
+		value := &strings.Builder{}
+		for i := 1; i < len(raw); i++ {
+			switch ch := raw[i]; {
+			case ch == '"':
+				return value.String(), checkDotenvRest(raw[i+1:])
+			case ch == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				case '"', '\\':
+					value.WriteByte(raw[i])
+				default:
+					value.WriteByte('\\')
+					value.WriteByte(raw[i])
+				}
+			default:
+				value.WriteByte(ch)
+			}
+		}
+		return "", fmt.Errorf("has an unterminated quote")
+	}
+	if idx := strings.Index(raw, " #"); idx >= 0 {
+		raw = raw[:idx]
+	}
+	return strings.TrimSpace(raw), nil
+}
+
+func checkDotenvRest(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if len(rest) > 0 && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("has unexpected characters after a quoted value")
+	}
+	return nil
+}
+
+// LoadDotenv reads the variables of a dotenv file, they are looked up before
+// the environment of the process, or the lookup given to SetEnvLookup. The
+// variables of a file loaded later win. The preset "dotenv" loads a file
+// when the instance is created, a missing file is ignored then.
+func (c *TagManager) LoadDotenv(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	values, err := ParseDotenv(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	next := c.lookupEnv
+	if next == nil {
+		next = os.LookupEnv
+	}
+	c.lookupEnv = func(key string) (string, bool) {
+		if value, ok := values[key]; ok {
+			return value, true
+		}
+		return next(key)
+	}
+	c.clearCache()
+	c.log("codetags: dotenv loaded", "path", path, "variables", len(values))
+	return nil
+}
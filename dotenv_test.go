@@ -0,0 +1,64 @@
+package codetags
+
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestParseDotenv(t *testing.T) {
+	values, err := ParseDotenv(strings.NewReader(`
+# local setup
+DOTENV_INCLUDED_TAGS=tag-1,tag-2
+export DOTENV_EXCLUDED_TAGS = "tag-3" # the broken one
+SINGLE='a "literal" \n # value'
+DOUBLE="line-1\nline-2 \"quoted\" # kept"
+BARE=some value # comment
+EMPTY=
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"DOTENV_INCLUDED_TAGS": "tag-1,tag-2",
+		"DOTENV_EXCLUDED_TAGS": "tag-3",
+		"SINGLE":               `a "literal" \n # value`,
+		"DOUBLE":               "line-1\nline-2 \"quoted\" # kept",
+		"BARE":                 "some value",
+		"EMPTY":                "",
+	}, values)
+
+	var tableInvalidCases = []string{
+		"NO_VALUE",
+		"1KEY=value",
+		"KEY='unterminated",
+		`KEY="unterminated`,
+		`KEY="value" trailing`,
+	}
+	for i, text := range tableInvalidCases {
+		if _, err := ParseDotenv(strings.NewReader(text)); err == nil {
+			t.Errorf("testcase[%d] - ParseDotenv(%q): must return a non-nil error", i, text)
+		}
+	}
+}
+
+func TestLoadDotenv(t *testing.T) {
+	os.Setenv("DOTENV_INCLUDED_TAGS", "tag-4")
+	os.Setenv("DOTENV_NEGATIVE_TAGS", "tag-5")
+	dir := t.TempDir()
+	filename := filepath.Join(dir, ".env")
+	assert.Nil(t, os.WriteFile(filename, []byte("DOTENV_INCLUDED_TAGS=tag-1,tag-2\n"), 0644))
+
+	ct := newTestInstance(t, "dotenv", &Presets{"namespace": "Dotenv", "EXCLUDED_TAGS": "NEGATIVE_TAGS", "dotenv": filename})
+	assert.Equal(t, []string{"tag-1", "tag-2"}, ct.GetIncludedTags())
+	assert.Equal(t, []string{"tag-5"}, ct.GetExcludedTags())
+
+	override := filepath.Join(dir, ".env.local")
+	assert.Nil(t, os.WriteFile(override, []byte("DOTENV_NEGATIVE_TAGS=tag-2\n"), 0644))
+	assert.Nil(t, ct.LoadDotenv(override))
+	assert.Equal(t, []string{"tag-1", "tag-2"}, ct.GetIncludedTags())
+	assert.Equal(t, []string{"tag-2"}, ct.GetExcludedTags())
+	assert.True(t, ct.IsActive("tag-1"))
+	assert.False(t, ct.IsActive("tag-2"))
+
+	assert.NotNil(t, ct.LoadDotenv(filepath.Join(dir, "missing")))
+	newTestInstance(t, "dotenv-missing", &Presets{"dotenv": filepath.Join(dir, "missing")})
+}
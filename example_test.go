@@ -238,3 +238,18 @@ func ExampleTagManager_Register_declaredMoreThanOneTime() {
 	// Tag [feature-11] is declared more than one time
 	// Tag [feature-14] is declared more than one time
 }
+
+func ExampleNewRegistry() {
+	os.Setenv("BILLING_INCLUDED_TAGS", "tag-1")
+
+	registry := codetags.NewRegistry()
+	tagHandler, _ := registry.Get("billing", &codetags.Presets{
+		"namespace": "Billing",
+	})
+
+	fmt.Printf("instances: %v\n", registry.List())
+	fmt.Printf("tag-1: %v\n", tagHandler.IsActive("tag-1"))
+	// Output:
+	// instances: [BILLING]
+	// tag-1: true
+}
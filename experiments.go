@@ -0,0 +1,136 @@
+package codetags
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Experiment declares an A/B experiment, a subject is assigned to one of the
+// weighted variants by a hash of the salt, the experiment name and the
+// subject identifier, so the assignment is stable across processes.
+type Experiment struct {
+	Name     string
+	Salt     string
+	Variants []WeightedVariant
+	Note     string
+}
+
+// WeightedVariant is a variant of an experiment, the share of subjects
+// assigned to it is Weight divided by the sum of all weights.
+type WeightedVariant struct {
+	Name   string
+	Weight uint
+}
+
+// Assignment is passed to the OnAssignment callback for every exposure.
+type Assignment struct {
+	Namespace  string
+	Experiment string
+	Subject    string
+	Variant    string
+}
+
+// RegisterExperiments declares the experiments, they are activated like the
+// tags declared by Register. The first variant is the control group.
+func (c *TagManager) RegisterExperiments(experiments ...Experiment) error {
+	c.mu.Lock()
+	defer c.unlock()
+	defs := make([]interface{}, 0, len(experiments))
+	errs := []string{}
+	for _, experiment := range experiments {
+		if err := validateExperiment(experiment); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if _, ok := c.store.experiments[experiment.Name]; !ok && !listContains(c.store.declaredTags, experiment.Name) {
+			c.store.experiments[experiment.Name] = experiment
+		}
+		defs = append(defs, TagDescriptor{Name: experiment.Name, Note: experiment.Note})
+	}
+	errs = append(errs, c.register(defs)...)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func validateExperiment(experiment Experiment) error {
+	if len(experiment.Name) == 0 {
+		return fmt.Errorf("The name of an experiment must be not empty")
+	}
+	if len(experiment.Variants) == 0 {
+		return fmt.Errorf("Experiment [%s] has no variant", experiment.Name)
+	}
+	names := []string{}
+	total := uint(0)
+	for _, variant := range experiment.Variants {
+		if listContains(names, variant.Name) {
+			return fmt.Errorf("Experiment [%s] has variant [%s] more than one time", experiment.Name, variant.Name)
+		}
+		names = append(names, variant.Name)
+		total += variant.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("Experiment [%s] has no weight", experiment.Name)
+	}
+	return nil
+}
+
+// OnAssignment sets the callback which is invoked each time Assign returns a
+// variant of an active experiment, e.g. to log exposures.
+func (c *TagManager) OnAssignment(fn func(Assignment)) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	c.onAssignment = fn
+	return c
+}
+
+// Assign returns the variant of the experiment for the subject. An inactive
+// experiment assigns every subject to the control group without invoking the
+// callback, an unknown experiment returns an empty string.
+func (c *TagManager) Assign(experiment string, subjectID string) string {
+	c.mu.Lock()
+	info, ok := c.store.experiments[experiment]
+	if !ok {
+		c.unlock()
+		return ""
+	}
+	if !c.checkLabelActivated(experiment) {
+		c.unlock()
+		return info.Variants[0].Name
+	}
+	namespace, onAssignment := c.getLabel("namespace"), c.onAssignment
+	// the callback may call back into the manager
+	c.unlock()
+	total := uint64(0)
+	for _, variant := range info.Variants {
+		total += uint64(variant.Weight)
+	}
+	point := bucketOf(info.Salt+":"+info.Name+":"+subjectID, total)
+	variant := info.Variants[0].Name
+	for _, candidate := range info.Variants {
+		if point < uint64(candidate.Weight) {
+			variant = candidate.Name
+			break
+		}
+		point -= uint64(candidate.Weight)
+	}
+	if onAssignment != nil {
+		onAssignment(Assignment{
+			Namespace:  namespace,
+			Experiment: experiment,
+			Subject:    subjectID,
+			Variant:    variant,
+		})
+	}
+	return variant
+}
+
+// bucketOf maps a key to one of the buckets [0, size) uniformly.
+func bucketOf(key string, size uint64) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8]) % size
+}
@@ -0,0 +1,97 @@
+package codetags
+
+import "fmt"
+import "os"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestAssign_distribution(t *testing.T) {
+	ct := newTestInstance(t, "experiments")
+	err := ct.RegisterExperiments(Experiment{
+		Name: "checkout",
+		Variants: []WeightedVariant{
+			{Name: "control", Weight: 50},
+			{Name: "a", Weight: 25},
+			{Name: "b", Weight: 25},
+		},
+	})
+	assert.Nil(t, err)
+
+	exposures := 0
+	ct.OnAssignment(func(assignment Assignment) {
+		exposures++
+	})
+
+	total := 20000
+	counts := map[string]int{}
+	for i := 0; i < total; i++ {
+		counts[ct.Assign("checkout", fmt.Sprintf("user-%d", i))]++
+	}
+	assert.Equal(t, total, exposures)
+	assert.Equal(t, 3, len(counts))
+	for variant, share := range map[string]float64{"control": 0.5, "a": 0.25, "b": 0.25} {
+		actual := float64(counts[variant]) / float64(total)
+		assert.InDelta(t, share, actual, 0.02, "variant [%s]", variant)
+	}
+}
+
+func TestAssign_stable(t *testing.T) {
+	ct := newTestInstance(t, "experiments-stable")
+	variants := []WeightedVariant{{Name: "control", Weight: 1}, {Name: "treatment", Weight: 1}}
+	assert.Nil(t, ct.RegisterExperiments(
+		Experiment{Name: "exp-1", Variants: variants},
+		Experiment{Name: "exp-2", Variants: variants, Salt: "2019"},
+	))
+
+	assignments := []Assignment{}
+	ct.OnAssignment(func(assignment Assignment) {
+		assignments = append(assignments, assignment)
+	})
+
+	differences := 0
+	for i := 0; i < 100; i++ {
+		subject := fmt.Sprintf("user-%d", i)
+		first := ct.Assign("exp-1", subject)
+		assert.Equal(t, first, ct.Assign("exp-1", subject))
+		if first != ct.Assign("exp-2", subject) {
+			differences++
+		}
+	}
+	// both experiments have their own buckets
+	assert.True(t, differences > 0)
+	assert.Equal(t, Assignment{
+		Namespace:  DEFAULT_NAMESPACE,
+		Experiment: "exp-1",
+		Subject:    "user-0",
+		Variant:    assignments[0].Variant,
+	}, assignments[0])
+	assert.Equal(t, "", ct.Assign("exp-3", "user-0"))
+}
+
+func TestAssign_inactive(t *testing.T) {
+	os.Setenv("EXPERIMENTSOFF_EXCLUDED_TAGS", "checkout")
+
+	ct := newTestInstance(t, "experiments-off", &Presets{"namespace": "ExperimentsOff"})
+	assert.Nil(t, ct.RegisterExperiments(Experiment{
+		Name:     "checkout",
+		Variants: []WeightedVariant{{Name: "control", Weight: 1}, {Name: "treatment", Weight: 99}},
+	}))
+	ct.OnAssignment(func(assignment Assignment) {
+		t.Errorf("an inactive experiment must not be exposed")
+	})
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "control", ct.Assign("checkout", fmt.Sprintf("user-%d", i)))
+	}
+}
+
+func TestRegisterExperiments_invalid(t *testing.T) {
+	ct := newTestInstance(t, "experiments-invalid")
+	err := ct.RegisterExperiments(
+		Experiment{Name: "exp-1"},
+		Experiment{Name: "exp-2", Variants: []WeightedVariant{{Name: "a"}}},
+		Experiment{Name: "exp-3", Variants: []WeightedVariant{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}},
+	)
+	assert.EqualError(t, err, "Experiment [exp-1] has no variant\n"+
+		"Experiment [exp-2] has no weight\n"+
+		"Experiment [exp-3] has variant [a] more than one time")
+}
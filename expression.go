@@ -0,0 +1,142 @@
+package codetags
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseExpression converts a textual tag expression such as `a && !(b || c)`
+// into the expression structure accepted by IsActive. `&&` binds tighter than
+// `||`, `!` negates the following term and parentheses group sub-expressions.
+func ParseExpression(text string) (interface{}, error) {
+	p := &expressionParser{tokens: tokenizeExpression(text)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("Expression must be not empty")
+	}
+	exp, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected token [%s] at position %d", p.tokens[p.pos], p.pos)
+	}
+	return exp, nil
+}
+
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *expressionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *expressionParser) parseOr() (interface{}, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	subexps := []interface{}{first}
+	for p.peek() == "||" {
+		p.pos++
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		subexps = append(subexps, next)
+	}
+	if len(subexps) == 1 {
+		return first, nil
+	}
+	return map[string]interface{}{"$any": subexps}, nil
+}
+
+func (p *expressionParser) parseAnd() (interface{}, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	subexps := []interface{}{first}
+	for p.peek() == "&&" {
+		p.pos++
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		subexps = append(subexps, next)
+	}
+	if len(subexps) == 1 {
+		return first, nil
+	}
+	return subexps, nil
+}
+
+func (p *expressionParser) parseUnary() (interface{}, error) {
+	if p.peek() == "!" {
+		p.pos++
+		subexp, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"$not": subexp}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (interface{}, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("Unexpected end of expression")
+	case "(":
+		p.pos++
+		exp, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("Missing closing parenthesis at position %d", p.pos)
+		}
+		p.pos++
+		return exp, nil
+	case ")", "&&", "||":
+		return nil, fmt.Errorf("Unexpected token [%s] at position %d", token, p.pos)
+	}
+	p.pos++
+	return token, nil
+}
+
+func tokenizeExpression(text string) []string {
+	tokens := make([]string, 0)
+	label := strings.Builder{}
+	flush := func() {
+		if label.Len() > 0 {
+			tokens = append(tokens, label.String())
+			label.Reset()
+		}
+	}
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')' || r == '!':
+			flush()
+			tokens = append(tokens, string(r))
+		case (r == '&' || r == '|') && i+1 < len(runes) && runes[i+1] == r:
+			flush()
+			tokens = append(tokens, string([]rune{r, r}))
+			i++
+		default:
+			label.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,68 @@
+package codetags
+
+import "testing"
+import "reflect"
+import "github.com/stretchr/testify/assert"
+
+func TestParseExpression(t *testing.T) {
+	var tableParseExpressionCases = []struct {
+		text     string
+		expected interface{}
+	}{
+		{
+			text:     "abc",
+			expected: "abc",
+		},
+		{
+			text:     "abc && !xyz",
+			expected: []interface{}{"abc", map[string]interface{}{"$not": "xyz"}},
+		},
+		{
+			text: "abc || def && xyz",
+			expected: map[string]interface{}{"$any": []interface{}{
+				"abc", []interface{}{"def", "xyz"},
+			}},
+		},
+		{
+			text: "!(tag-1||tag-2) && tag-3",
+			expected: []interface{}{
+				map[string]interface{}{"$not": map[string]interface{}{"$any": []interface{}{"tag-1", "tag-2"}}},
+				"tag-3",
+			},
+		},
+	}
+	for i, c := range tableParseExpressionCases {
+		actual, err := ParseExpression(c.text)
+		if err != nil {
+			t.Errorf("testcase[%d] - unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("testcase[%d] - actual[%v] is different with expected [%v]", i, actual, c.expected)
+		}
+	}
+}
+
+func TestParseExpression_invalid(t *testing.T) {
+	for _, text := range []string{"", "  ", "abc &&", "(abc", "abc)", "|| abc", "abc def"} {
+		_, err := ParseExpression(text)
+		if err == nil {
+			t.Errorf("ParseExpression('%s'): must return a non-nil error", text)
+		}
+	}
+}
+
+func TestParseExpression_evaluate(t *testing.T) {
+	ct := newTestInstance(t, "parse-expression", &Presets{"namespace": "ParseExpression"})
+	ct.Register([]interface{}{"tag-1", "tag-2"})
+
+	evaluate := func(text string) bool {
+		exp, err := ParseExpression(text)
+		assert.Nil(t, err)
+		return ct.IsActive(exp)
+	}
+	assert.True(t, evaluate("tag-1 && tag-2"))
+	assert.True(t, evaluate("tag-1 && !tag-3"))
+	assert.True(t, evaluate("tag-3 || tag-2"))
+	assert.False(t, evaluate("tag-1 && tag-3"))
+	assert.False(t, evaluate("!(tag-1 || tag-3)"))
+}
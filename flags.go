@@ -0,0 +1,97 @@
+package codetags
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+)
+
+// BindFlags registers the -enable-tags and -disable-tags flags on fs, both
+// take a comma-separated list of tags. The flags take precedence over the
+// INCLUDED_TAGS and EXCLUDED_TAGS environment variables and the declared
+// tags, the overrides take precedence over the flags. When a tag is given
+// several times, the last flag wins. The flags are kept by ClearCache and
+// Reset.
+func BindFlags(fs *flag.FlagSet, c *TagManager) {
+	fs.Var(&tagListFlag{manager: c, enabled: true}, "enable-tags",
+		"comma-separated list of tags to turn on")
+	fs.Var(&tagListFlag{manager: c, enabled: false}, "disable-tags",
+		"comma-separated list of tags to turn off")
+}
+
+// BindTagFlags registers a boolean flag -tag-<name> on fs for every declared
+// tag, -tag-<name>=false turns the tag off. They have the precedence of the
+// flags of BindFlags, so the tags must be registered before.
+func BindTagFlags(fs *flag.FlagSet, c *TagManager) {
+	for _, tag := range c.GetDeclaredTags() {
+		fs.Var(&tagFlag{manager: c, tag: tag}, "tag-"+tag, "turn the tag "+tag+" on or off")
+	}
+}
+
+// FlagTags returns the tags turned on or off by the command-line flags.
+func (c *TagManager) FlagTags() map[string]bool {
+	c.mu.Lock()
+	defer c.unlock()
+	tags := make(map[string]bool, len(c.store.flagTags))
+	for tag, enabled := range c.store.flagTags {
+		tags[tag] = enabled
+	}
+	return tags
+}
+
+func (c *TagManager) setFlagTag(tag string, enabled bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.store.flagTags[tag] = enabled
+	delete(c.store.cachedTags, tag)
+	c.log("codetags: flag set", "tag", tag, "enabled", enabled)
+	c.changed()
+}
+
+type tagListFlag struct {
+	manager *TagManager
+	enabled bool
+	tags    []string
+}
+
+func (f *tagListFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.tags, ",")
+}
+
+func (f *tagListFlag) Set(value string) error {
+	for _, tag := range stringToList(value) {
+		f.tags = append(f.tags, tag)
+		f.manager.setFlagTag(tag, f.enabled)
+	}
+	return nil
+}
+
+type tagFlag struct {
+	manager *TagManager
+	tag     string
+	value   string
+}
+
+func (f *tagFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *tagFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	f.value = value
+	f.manager.setFlagTag(f.tag, enabled)
+	return nil
+}
+
+func (f *tagFlag) IsBoolFlag() bool {
+	return true
+}
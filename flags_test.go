@@ -0,0 +1,49 @@
+package codetags
+
+import "flag"
+import "io"
+import "os"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestBindFlags(t *testing.T) {
+	os.Setenv("BINDFLAGS_INCLUDED_TAGS", "tag-3")
+	os.Setenv("BINDFLAGS_EXCLUDED_TAGS", "tag-2")
+
+	ct := newTestInstance(t, "bind-flags", &Presets{"namespace": "BindFlags"})
+	ct.Register([]interface{}{"tag-1", "tag-2"})
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	BindFlags(fs, ct)
+	BindTagFlags(fs, ct)
+	changes := 0
+	ct.watch(func() { changes++ })
+
+	assert.Nil(t, fs.Parse([]string{"-enable-tags", "tag-2, tag-4", "-disable-tags=tag-3", "-tag-tag-1=false"}))
+	assert.Equal(t, map[string]bool{"tag-1": false, "tag-2": true, "tag-3": false, "tag-4": true}, ct.FlagTags())
+	// the watchers see every flag
+	assert.Equal(t, 4, changes)
+	assert.False(t, ct.IsActive("tag-1"))
+	assert.True(t, ct.IsActive("tag-2"))
+	assert.False(t, ct.IsActive("tag-3"))
+	assert.True(t, ct.IsActive("tag-4"))
+
+	// the overrides take precedence over the flags
+	ct.Override("tag-2", false)
+	assert.False(t, ct.IsActive("tag-2"))
+
+	ct.Reset().Initialize(&Presets{"namespace": "BindFlags"})
+	assert.True(t, ct.IsActive("tag-4"))
+	assert.False(t, ct.IsActive("tag-3"))
+}
+
+func TestBindTagFlags_invalid(t *testing.T) {
+	ct := newTestInstance(t, "bind-tag-flags")
+	ct.Register([]interface{}{"tag-1"})
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	BindTagFlags(fs, ct)
+
+	assert.NotNil(t, fs.Parse([]string{"-tag-tag-1=maybe"}))
+	assert.Nil(t, fs.Parse([]string{"-tag-tag-1"}))
+	assert.Equal(t, map[string]bool{"tag-1": true}, ct.FlagTags())
+}
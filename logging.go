@@ -0,0 +1,56 @@
+package codetags
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger sets the logger receiving the audit events of the manager:
+// preset changes, registered and filtered-out tags, environment refreshes
+// and resets. A nil logger, the default, disables them.
+func (c *TagManager) SetLogger(logger *slog.Logger) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	c.logger = logger
+	return c
+}
+
+// logEvent is an event logged while the lock of the manager is held, it is
+// emitted by unlock.
+type logEvent struct {
+	logger *slog.Logger
+	level  slog.Level
+	msg    string
+	args   []interface{}
+}
+
+func (c *TagManager) warn(msg string, args ...interface{}) {
+	c.addLogEvent(slog.LevelWarn, msg, args)
+}
+
+func (c *TagManager) log(msg string, args ...interface{}) {
+	c.addLogEvent(slog.LevelInfo, msg, args)
+}
+
+func (c *TagManager) addLogEvent(level slog.Level, msg string, args []interface{}) {
+	if c.logger == nil {
+		return
+	}
+	c.logEvents = append(c.logEvents, logEvent{
+		logger: c.logger,
+		level:  level,
+		msg:    msg,
+		args:   append([]interface{}{"namespace", c.getLabel("namespace")}, args...),
+	})
+}
+
+// unlock releases the lock of the manager then emits the events logged under
+// it, so a slow or re-entrant handler never runs with the lock held.
+func (c *TagManager) unlock() {
+	events := c.logEvents
+	c.logEvents = nil
+	c.mu.Unlock()
+	for _, event := range events {
+		event.logger.Log(context.Background(), event.level, event.msg, event.args...)
+	}
+}
@@ -0,0 +1,92 @@
+package codetags
+
+import "bytes"
+import "context"
+import "encoding/json"
+import "log/slog"
+import "os"
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func readLogEvents(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	events := []map[string]interface{}{}
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		event := map[string]interface{}{}
+		assert.Nil(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestSetLogger(t *testing.T) {
+	os.Setenv("LOGGING_INCLUDED_TAGS", "tag-9")
+
+	buf := &bytes.Buffer{}
+	ct := newTestInstance(t, "logging")
+	ct.SetLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+
+	ct.Initialize(&Presets{"namespace": "Logging", "version": "0.1.7"})
+	ct.Register([]interface{}{
+		"tag-1",
+		TagDescriptor{Name: "tag-2", Plan: TagPlan{Enabled: true, MinBound: "0.2.0"}},
+	})
+	// the environment is unchanged, the refresh is not logged
+	ct.ClearCache()
+	ct.Reset()
+
+	events := readLogEvents(t, buf)
+	messages := []string{}
+	for _, event := range events {
+		messages = append(messages, event["msg"].(string))
+	}
+	assert.Equal(t, []string{
+		"codetags: preset changed",
+		"codetags: preset changed",
+		"codetags: environment refreshed",
+		"codetags: descriptor filtered out",
+		"codetags: tags registered",
+		"codetags: reset",
+	}, messages)
+	assert.Equal(t, "LOGGING", events[1]["new"])
+	assert.Equal(t, []interface{}{"tag-9"}, events[2]["included_added"])
+	assert.Equal(t, "tag-2", events[3]["tag"])
+	assert.Equal(t, "version 0.1.7 is out of the bounds of an enabled plan", events[3]["reason"])
+	assert.Equal(t, []interface{}{"tag-1"}, events[4]["declared"])
+	assert.Equal(t, "LOGGING", events[5]["namespace"])
+}
+
+// reentrantHandler calls the manager from the handler.
+type reentrantHandler struct {
+	manager *TagManager
+	active  []bool
+}
+
+func (h *reentrantHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *reentrantHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *reentrantHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *reentrantHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.active = append(h.active, h.manager.IsActive("tag-1"))
+	return nil
+}
+
+func TestSetLogger_reentrant(t *testing.T) {
+	ct := newTestInstance(t, "logging-reentrant")
+	handler := &reentrantHandler{manager: ct}
+	ct.SetLogger(slog.New(handler))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ct.Register([]interface{}{"tag-1"})
+		ct.Override("tag-1", false)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the logger is called with the lock of the manager held")
+	}
+	assert.Equal(t, []bool{true, false}, handler.active)
+}
@@ -0,0 +1,94 @@
+package codetags
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics counts the results of tag evaluations per namespace and tag, and
+// serves them in the Prometheus text exposition format. A Metrics may be
+// shared by several managers.
+type Metrics struct {
+	mu     sync.Mutex
+	counts map[metricKey]uint64
+}
+
+type metricKey struct {
+	namespace string
+	tag       string
+	result    bool
+}
+
+// NewMetrics creates an empty metrics collector.
+func NewMetrics() *Metrics {
+	return &Metrics{counts: make(map[metricKey]uint64)}
+}
+
+// SetMetrics attaches the collector to the manager, nil detaches it.
+func (c *TagManager) SetMetrics(m *Metrics) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	c.metrics = m
+	return c
+}
+
+func (m *Metrics) observe(namespace string, tag string, result bool) {
+	m.mu.Lock()
+	m.counts[metricKey{namespace, tag, result}]++
+	m.mu.Unlock()
+}
+
+// Count returns the number of evaluations of the tag with the given result.
+func (m *Metrics) Count(namespace string, tag string, result bool) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[metricKey{labelify(namespace), tag, result}]
+}
+
+// WriteTo writes the counters in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	keys := make([]metricKey, 0, len(m.counts))
+	for key := range m.counts {
+		keys = append(keys, key)
+	}
+	counts := make(map[metricKey]uint64, len(m.counts))
+	for key, count := range m.counts {
+		counts[key] = count
+	}
+	m.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		if keys[i].tag != keys[j].tag {
+			return keys[i].tag < keys[j].tag
+		}
+		return !keys[i].result && keys[j].result
+	})
+	out := &strings.Builder{}
+	out.WriteString("# HELP codetags_evaluations_total Number of tag evaluations by result.\n")
+	out.WriteString("# TYPE codetags_evaluations_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(out, "codetags_evaluations_total{namespace=\"%s\",tag=\"%s\",result=\"%t\"} %d\n",
+			escapeLabelValue(key.namespace), escapeLabelValue(key.tag), key.result, counts[key])
+	}
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the counters to a Prometheus scraper.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
@@ -0,0 +1,33 @@
+package codetags
+
+import "net/http/httptest"
+import "os"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestMetrics(t *testing.T) {
+	os.Setenv("METRICS_EXCLUDED_TAGS", "tag-2")
+
+	metrics := NewMetrics()
+	ct := newTestInstance(t, "metrics", &Presets{"namespace": "Metrics"})
+	ct.SetMetrics(metrics).Register([]interface{}{"tag-1", "tag-2"})
+
+	ct.IsActive("tag-1")
+	ct.IsActive("tag-1", "tag-2")
+	ct.IsActive([]interface{}{"tag-2", "tag-1"})
+	ct.Eval(Not(Tag(`say "hi"`)))
+
+	assert.Equal(t, uint64(2), metrics.Count("metrics", "tag-1", true))
+	assert.Equal(t, uint64(0), metrics.Count("metrics", "tag-1", false))
+	assert.Equal(t, uint64(1), metrics.Count("metrics", "tag-2", false))
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP codetags_evaluations_total Number of tag evaluations by result.
+# TYPE codetags_evaluations_total counter
+codetags_evaluations_total{namespace="METRICS",tag="say \"hi\"",result="false"} 1
+codetags_evaluations_total{namespace="METRICS",tag="tag-1",result="true"} 2
+codetags_evaluations_total{namespace="METRICS",tag="tag-2",result="false"} 1
+`, recorder.Body.String())
+}
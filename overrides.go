@@ -0,0 +1,227 @@
+package codetags
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// OverrideRecord describes a runtime override with its audit metadata.
+type OverrideRecord struct {
+	Tag       string    `json:"tag"`
+	Enabled   bool      `json:"enabled"`
+	Author    string    `json:"author,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type override struct {
+	OverrideRecord
+	timer *time.Timer
+}
+
+func (o *override) stop() {
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+}
+
+// Override turns a tag on or off at runtime. An override takes precedence
+// over the declared, included and excluded tags and survives ClearCache; an
+// optional TTL reverts it automatically after the duration. The error of the
+// save into the override store is given by LastSaveError.
+func (c *TagManager) Override(tag string, enabled bool, ttl ...time.Duration) *TagManager {
+	record := OverrideRecord{Tag: tag, Enabled: enabled, CreatedAt: time.Now()}
+	if len(ttl) > 0 && ttl[0] > 0 {
+		record.ExpiresAt = record.CreatedAt.Add(ttl[0])
+	}
+	c.ApplyOverride(record)
+	return c
+}
+
+// ApplyOverride sets an override with its audit metadata, a non-zero
+// ExpiresAt reverts it at that time. An expired record reverts the
+// override of the tag at once. The
+// override is applied even when it cannot be saved into the override store,
+// the error of the save is returned.
+func (c *TagManager) ApplyOverride(record OverrideRecord) error {
+	c.mu.Lock()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	var pending *pendingSave
+	if c.applyOverride(record) {
+		pending = c.prepareSave()
+	}
+	c.unlock()
+	return c.save(pending)
+}
+
+func (c *TagManager) applyOverride(record OverrideRecord) bool {
+	tag := record.Tag
+	o := &override{OverrideRecord: record}
+	if !record.ExpiresAt.IsZero() {
+		ttl := time.Until(record.ExpiresAt)
+		if ttl <= 0 {
+			if !c.removeOverride(tag) {
+				return false
+			}
+			c.log("codetags: override expired", "tag", tag)
+			return true
+		}
+		o.timer = time.AfterFunc(ttl, func() {
+			c.mu.Lock()
+			var pending *pendingSave
+			if c.store.overrides[tag] == o {
+				c.removeOverride(tag)
+				c.log("codetags: override expired", "tag", tag)
+				pending = c.prepareSave()
+			}
+			c.unlock()
+			c.save(pending)
+		})
+	}
+	if previous, ok := c.store.overrides[tag]; ok {
+		previous.stop()
+	}
+	c.store.overrides[tag] = o
+	delete(c.store.cachedTags, tag)
+	c.log("codetags: override set", "tag", tag, "enabled", record.Enabled,
+		"author", record.Author, "reason", record.Reason, "expires", record.ExpiresAt)
+	c.changed()
+	return true
+}
+
+// RemoveOverride reverts a tag to the state given by the declared, included
+// and excluded tags. The error of the save into the override store is given
+// by LastSaveError.
+func (c *TagManager) RemoveOverride(tag string) *TagManager {
+	c.mu.Lock()
+	var pending *pendingSave
+	if c.removeOverride(tag) {
+		c.log("codetags: override removed", "tag", tag)
+		pending = c.prepareSave()
+	}
+	c.unlock()
+	c.save(pending)
+	return c
+}
+
+func (c *TagManager) removeOverride(tag string) bool {
+	o, ok := c.store.overrides[tag]
+	if !ok {
+		return false
+	}
+	o.stop()
+	delete(c.store.overrides, tag)
+	delete(c.store.cachedTags, tag)
+	c.changed()
+	return true
+}
+
+// Overrides returns the overridden tags and their states.
+func (c *TagManager) Overrides() map[string]bool {
+	c.mu.Lock()
+	defer c.unlock()
+	overrides := make(map[string]bool, len(c.store.overrides))
+	for tag, o := range c.store.overrides {
+		overrides[tag] = o.Enabled
+	}
+	return overrides
+}
+
+// OverrideRecords returns the overrides with their audit metadata, sorted by tag.
+func (c *TagManager) OverrideRecords() []OverrideRecord {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.getOverrideRecords()
+}
+
+func (c *TagManager) getOverrideRecords() []OverrideRecord {
+	records := make([]OverrideRecord, 0, len(c.store.overrides))
+	for _, o := range c.store.overrides {
+		records = append(records, o.OverrideRecord)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Tag < records[j].Tag
+	})
+	return records
+}
+
+// SetOverrideStore restores the overrides saved in the store and saves
+// every later change of the overrides into it. A nil store detaches it. The
+// current store stays attached when the new one cannot be loaded.
+func (c *TagManager) SetOverrideStore(store OverrideStore) error {
+	var records []OverrideRecord
+	if store != nil {
+		var err error
+		if records, err = store.Load(); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	c.overrideStore = nil
+	if store == nil {
+		return nil
+	}
+	for _, record := range records {
+		c.applyOverride(record)
+	}
+	c.overrideStore = store
+	return nil
+}
+
+// overrideSaver runs the saves into the override store outside of the lock
+// of the manager, in the order of the changes; a save older than the last
+// written one is dropped.
+type overrideSaver struct {
+	mu    sync.Mutex
+	seq   uint64 // guarded by the lock of the manager
+	saved uint64
+	err   error
+}
+
+type pendingSave struct {
+	store   OverrideStore
+	records []OverrideRecord
+	seq     uint64
+}
+
+// prepareSave takes the records to save, the lock of the manager is held.
+func (c *TagManager) prepareSave() *pendingSave {
+	if c.overrideStore == nil {
+		return nil
+	}
+	c.saver.seq++
+	return &pendingSave{store: c.overrideStore, records: c.getOverrideRecords(), seq: c.saver.seq}
+}
+
+// save writes the records of prepareSave, the lock of the manager is not held.
+func (c *TagManager) save(pending *pendingSave) error {
+	if pending == nil {
+		return nil
+	}
+	c.saver.mu.Lock()
+	defer c.saver.mu.Unlock()
+	if pending.seq <= c.saver.saved {
+		return nil
+	}
+	err := pending.store.Save(pending.records)
+	c.saver.saved, c.saver.err = pending.seq, err
+	if err != nil {
+		c.mu.Lock()
+		c.warn("codetags: overrides are not saved", "error", err)
+		c.unlock()
+	}
+	return err
+}
+
+// LastSaveError returns the error of the last save into the override store,
+// nil when it succeeded.
+func (c *TagManager) LastSaveError() error {
+	c.saver.mu.Lock()
+	defer c.saver.mu.Unlock()
+	return c.saver.err
+}
@@ -0,0 +1,60 @@
+package codetags
+
+import "os"
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func TestOverride(t *testing.T) {
+	os.Setenv("OVERRIDE_INCLUDED_TAGS", "abc")
+	os.Setenv("OVERRIDE_EXCLUDED_TAGS", "tag-2")
+
+	ct := newTestInstance(t, "override", &Presets{"namespace": "Override"})
+	ct.Register([]interface{}{"tag-1", "tag-2"})
+
+	assert.True(t, ct.IsActive("tag-1"))
+	assert.False(t, ct.IsActive("tag-2"))
+	assert.True(t, ct.IsActive("abc"))
+
+	ct.Override("tag-1", false).Override("tag-2", true).Override("abc", false).Override("xyz", true)
+	assert.False(t, ct.IsActive("tag-1"))
+	assert.True(t, ct.IsActive("tag-2"))
+	assert.False(t, ct.IsActive("abc"))
+	assert.True(t, ct.IsActive("xyz"))
+	assert.Equal(t, map[string]bool{"tag-1": false, "tag-2": true, "abc": false, "xyz": true}, ct.Overrides())
+
+	ct.ClearCache()
+	assert.True(t, ct.IsActive("tag-2"))
+	assert.False(t, ct.IsActive("abc"))
+
+	ct.RemoveOverride("tag-2").RemoveOverride("abc").RemoveOverride("unknown")
+	assert.False(t, ct.IsActive("tag-2"))
+	assert.True(t, ct.IsActive("abc"))
+
+	ct.Reset()
+	assert.Empty(t, ct.Overrides())
+}
+
+func TestOverride_ttl(t *testing.T) {
+	ct := newTestInstance(t, "override-ttl")
+	ct.Register([]interface{}{"tag-1"})
+
+	ct.Override("tag-1", false, 20*time.Millisecond)
+	assert.False(t, ct.IsActive("tag-1"))
+	assert.Eventually(t, func() bool {
+		return ct.IsActive("tag-1")
+	}, time.Second, 5*time.Millisecond)
+	assert.Empty(t, ct.Overrides())
+
+	// a new override cancels the expiration of the previous one
+	ct.Override("tag-1", false, 20*time.Millisecond)
+	ct.Override("tag-1", false)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, ct.IsActive("tag-1"))
+
+	// an expired record reverts the override of the tag
+	err := ct.ApplyOverride(OverrideRecord{Tag: "tag-1", Enabled: false, ExpiresAt: time.Now().Add(-time.Second)})
+	assert.Nil(t, err)
+	assert.True(t, ct.IsActive("tag-1"))
+	assert.Empty(t, ct.Overrides())
+}
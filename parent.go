@@ -0,0 +1,86 @@
+package codetags
+
+import (
+	"fmt"
+	"sync"
+)
+
+// parentMu serializes the changes of parents, so two concurrent SetParent
+// cannot build a cycle that each of them alone would have refused.
+var parentMu sync.Mutex
+
+// SetParent makes the manager fall back to the parent for the tags which are
+// neither overridden, excluded, included nor declared by the manager itself.
+// The results coming from the parent are not cached, so a ClearCache of the
+// parent is seen by its children. A nil parent detaches it.
+//
+// The preset "parent" names the parent when an instance is created by
+// GetInstance or NewInstance, the parent must be in the same registry.
+func (c *TagManager) SetParent(parent *TagManager) error {
+	parentMu.Lock()
+	defer parentMu.Unlock()
+	for p := parent; p != nil; p = p.Parent() {
+		if p == c {
+			return fmt.Errorf("The parent of a codetags instance must not be one of its children")
+		}
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	c.parent = parent
+	c.clearCache()
+	c.log("codetags: parent changed", "parent", parent != nil)
+	return nil
+}
+
+// Parent returns the parent of the manager, nil when it has none.
+func (c *TagManager) Parent() *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.parent
+}
+
+// LockExcludes makes the exclusion of the tags non-overridable: while one of
+// them is off in the manager itself, by an override, a command-line flag,
+// the remote layer or its excluded tags, it is off in every descendant,
+// whatever the descendant declares, includes or overrides. It turns these
+// tags of a parent into kill switches. A tag that the manager only leaves
+// undecided is not locked.
+func (c *TagManager) LockExcludes(tags ...string) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	for _, tag := range tags {
+		c.lockedTags[tag] = true
+	}
+	return c
+}
+
+// UnlockExcludes lets the descendants override the exclusion of the tags again.
+func (c *TagManager) UnlockExcludes(tags ...string) *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	for _, tag := range tags {
+		delete(c.lockedTags, tag)
+	}
+	return c
+}
+
+// isLockedOff reports whether the manager or one of its ancestors locks the
+// tag off, with the state it decides on its own.
+func (c *TagManager) isLockedOff(label string) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.lockedTags[label] {
+		if active, ok := c.ownLabelState(label); ok && !active {
+			return true
+		}
+	}
+	return c.parent != nil && c.parent.isLockedOff(label)
+}
+
+// inheritedState evaluates a tag for a child, the children are always locked
+// before their parents.
+func (c *TagManager) inheritedState(label string) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.forceCheckLabelActivated(label)
+}
@@ -0,0 +1,93 @@
+package codetags
+
+import "os"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestParent(t *testing.T) {
+	os.Setenv("PARENTGLOBAL_INCLUDED_TAGS", "global-1,child-2")
+	os.Setenv("PARENTGLOBAL_EXCLUDED_TAGS", "kill-1")
+	os.Setenv("PARENTBILLING_INCLUDED_TAGS", "kill-1")
+	os.Setenv("PARENTBILLING_EXCLUDED_TAGS", "global-2")
+
+	global := newTestInstance(t, "parent-global", &Presets{"namespace": "ParentGlobal"})
+	global.Register([]interface{}{"global-2", "global-3"})
+	billing := newTestInstance(t, "parent-billing", &Presets{"namespace": "ParentBilling", "parent": "parent-global"})
+	assert.True(t, billing.Parent() == global)
+	billing.Register([]interface{}{"child-1"})
+
+	assert.True(t, billing.IsActive("child-1"))
+	assert.True(t, billing.IsActive("global-1"))
+	assert.False(t, billing.IsActive("global-2"))
+	assert.True(t, billing.IsActive("global-3"))
+	assert.True(t, billing.IsActive("child-2"))
+	assert.True(t, billing.IsActive("kill-1"))
+	assert.False(t, billing.IsActive("unknown"))
+
+	// the results coming from the parent are not cached by the child
+	global.Override("global-3", false)
+	assert.False(t, billing.IsActive("global-3"))
+
+	global.LockExcludes("kill-1", "global-2")
+	assert.False(t, billing.IsActive("kill-1"))
+	billing.Override("kill-1", true)
+	assert.False(t, billing.IsActive("kill-1"))
+	// global-2 is not excluded by the parent, the lock has no effect
+	billing.Override("global-2", true)
+	assert.True(t, billing.IsActive("global-2"))
+	global.UnlockExcludes("kill-1")
+	assert.True(t, billing.IsActive("kill-1"))
+
+	// a kill switch turned off by an override or by the remote layer
+	global.LockExcludes("kill-2", "kill-3")
+	billing.Register([]interface{}{"kill-2", "kill-3"})
+	assert.True(t, billing.IsActive("kill-2"))
+	global.Override("kill-2", false)
+	assert.False(t, billing.IsActive("kill-2"))
+	assert.Nil(t, global.SetRemote(&TagSnapshot{SchemaVersion: SnapshotSchemaVersion, ExcludedTags: []string{"kill-3"}}))
+	assert.False(t, billing.IsActive("kill-3"))
+	global.RemoveOverride("kill-2")
+	global.ClearRemote()
+	assert.True(t, billing.IsActive("kill-2"))
+	assert.True(t, billing.IsActive("kill-3"))
+
+	assert.NotNil(t, global.SetParent(billing))
+	assert.Nil(t, billing.SetParent(nil))
+	assert.False(t, billing.IsActive("global-1"))
+
+	_, err := NewInstance("parent-orphan", &Presets{"parent": "parent-unknown"})
+	assert.NotNil(t, err)
+}
+
+func TestParent_grandparent(t *testing.T) {
+	os.Setenv("PARENTROOT_EXCLUDED_TAGS", "kill-1")
+
+	registry := NewRegistry()
+	root, _ := registry.New("root", &Presets{"namespace": "ParentRoot"})
+	root.Register([]interface{}{"root-1"}).LockExcludes("kill-1")
+	module, _ := registry.New("module", &Presets{"namespace": "ParentModule", "parent": "root"})
+	leaf, _ := registry.New("leaf", &Presets{"namespace": "ParentLeaf", "parent": "module"})
+	leaf.Register([]interface{}{"kill-1"})
+
+	assert.True(t, module == leaf.Parent())
+	assert.True(t, leaf.IsActive("root-1"))
+	assert.False(t, leaf.IsActive("kill-1"))
+	assert.True(t, leaf.Eval(All(Tag("root-1"), Not(Tag("kill-1")))))
+}
+
+func TestSetParent_concurrent(t *testing.T) {
+	// each SetParent alone is valid, together they would make a cycle
+	for i := 0; i < 50; i++ {
+		a, b := newTagManager(), newTagManager()
+		errs := make(chan error, 2)
+		go func() {
+			errs <- a.SetParent(b)
+		}()
+		go func() {
+			errs <- b.SetParent(a)
+		}()
+		first, second := <-errs, <-errs
+		assert.True(t, (first == nil) != (second == nil))
+		assert.False(t, a.Parent() == b && b.Parent() == a)
+	}
+}
@@ -0,0 +1,206 @@
+package codetags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// HTTPProvider keeps the remote layer of a manager in line with a
+// TagSnapshot served by an HTTP endpoint, as written by Export. It polls the
+// endpoint with the ETag of the last payload in If-None-Match, an update is
+// applied by SetRemote, so the manager never shows a partial state and keeps
+// its own declarations.
+type HTTPProvider struct {
+	// URL of the snapshot endpoint.
+	URL string
+	// Client sends the requests, nil uses http.DefaultClient.
+	Client *http.Client
+	// Interval between two polls, 30 seconds when zero.
+	Interval time.Duration
+	// MaxBackoff bounds the delay after failures, which doubles from
+	// Interval on each failure with a random jitter. 5 minutes when zero.
+	MaxBackoff time.Duration
+	// CachePath, when set, keeps the last good payload on disk, it is applied
+	// by Run before the first poll so a cold start works without the server.
+	CachePath string
+
+	manager *TagManager
+	mu      sync.Mutex
+	etag    string
+}
+
+// NewHTTPProvider creates a provider of the snapshot at url for the manager.
+func NewHTTPProvider(url string, c *TagManager) *HTTPProvider {
+	return &HTTPProvider{URL: url, manager: c}
+}
+
+type providerCache struct {
+	ETag     string          `json:"etag"`
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// Run loads the cached payload then polls the endpoint until ctx is done.
+func (p *HTTPProvider) Run(ctx context.Context) error {
+	if err := p.LoadCache(); err != nil && !os.IsNotExist(err) {
+		p.warn("codetags: provider cache is not loaded", err)
+	}
+	failures := 0
+	for {
+		if _, err := p.Fetch(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failures++
+			p.warn("codetags: provider fetch failed", err)
+		} else {
+			failures = 0
+		}
+		delay := p.interval()
+		if failures > 0 {
+			delay = jitter(backoff(delay, p.maxBackoff(), failures))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Fetch polls the endpoint once, it reports whether a new payload has been
+// applied.
+func (p *HTTPProvider) Fetch(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	p.mu.Lock()
+	if len(p.etag) > 0 {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	p.mu.Unlock()
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("Unexpected status [%s] from %s", resp.Status, p.URL)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if err := p.apply(resp.Header.Get("ETag"), data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// LoadCache applies the payload saved in CachePath.
+func (p *HTTPProvider) LoadCache() error {
+	if len(p.CachePath) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(p.CachePath)
+	if err != nil {
+		return err
+	}
+	cache := providerCache{}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return fmt.Errorf("%s: %v", p.CachePath, err)
+	}
+	if err := p.setRemote(cache.Snapshot); err != nil {
+		return fmt.Errorf("%s: %v", p.CachePath, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.etag = cache.ETag
+	return nil
+}
+
+// apply sets a payload as the remote layer, a good one is kept with its
+// ETag and cached. A bad one leaves the manager and the ETag unchanged.
+func (p *HTTPProvider) apply(etag string, data []byte) error {
+	if err := p.setRemote(data); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.etag = etag
+	p.mu.Unlock()
+	if len(p.CachePath) > 0 {
+		cache, err := json.Marshal(providerCache{ETag: etag, Snapshot: data})
+		if err == nil {
+			err = writeFileAtomic(p.CachePath, cache)
+		}
+		if err != nil {
+			p.warn("codetags: provider cache is not saved", err)
+		}
+	}
+	return nil
+}
+
+func (p *HTTPProvider) setRemote(data []byte) error {
+	snapshot := &TagSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return err
+	}
+	return p.manager.SetRemote(snapshot)
+}
+
+func (p *HTTPProvider) warn(msg string, err error) {
+	p.manager.mu.Lock()
+	defer p.manager.unlock()
+	p.manager.warn(msg, "url", p.URL, "error", err)
+}
+
+func (p *HTTPProvider) interval() time.Duration {
+	if p.Interval > 0 {
+		return p.Interval
+	}
+	return 30 * time.Second
+}
+
+func (p *HTTPProvider) maxBackoff() time.Duration {
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+	return 5 * time.Minute
+}
+
+// backoff doubles the interval for each failure, up to max.
+func backoff(interval, max time.Duration, failures int) time.Duration {
+	delay := interval
+	for i := 0; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// jitter spreads the retries of the clients over the second half of the
+// delay, so they do not hit a recovering server together.
+func jitter(delay time.Duration) time.Duration {
+	if delay < 2 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
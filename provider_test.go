@@ -0,0 +1,151 @@
+package codetags
+
+import "context"
+import "net/http"
+import "net/http/httptest"
+import "path/filepath"
+import "sync"
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func snapshotPayload(included ...string) []byte {
+	source := newTagManager()
+	source.Restore(&TagSnapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Presets:       Presets{"namespace": "PROVIDER"},
+		Descriptors:   []DescriptorSnapshot{{Name: "tag-1"}},
+		IncludedTags:  included,
+	})
+	data, _ := source.Export()
+	return data
+}
+
+func TestHTTPProvider_fetch(t *testing.T) {
+	var mu sync.Mutex
+	payload, etag := snapshotPayload("tag-2"), `"v1"`
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	ct := newTestInstance(t, "http-provider")
+	ct.Register([]interface{}{"tag-1"})
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	provider := NewHTTPProvider(server.URL, ct)
+	provider.CachePath = cachePath
+
+	changed, err := provider.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.True(t, ct.IsActive("tag-1", "tag-2"))
+
+	changed, err = provider.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	mu.Lock()
+	payload, etag = snapshotPayload("tag-3"), `"v2"`
+	mu.Unlock()
+	changed, err = provider.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.False(t, ct.IsActive("tag-2"))
+	assert.True(t, ct.IsActive("tag-3"))
+	assert.Equal(t, []string{"", `"v1"`, `"v1"`}, requests)
+
+	// a cold start uses the cached payload when the server is down
+	server.Close()
+	cold := newTestInstance(t, "http-provider-cold")
+	assert.False(t, cold.IsActive("tag-1"))
+	coldProvider := NewHTTPProvider(server.URL, cold)
+	coldProvider.CachePath = cachePath
+	assert.Nil(t, coldProvider.LoadCache())
+	assert.True(t, cold.IsActive("tag-3"))
+	_, err = coldProvider.Fetch(context.Background())
+	assert.NotNil(t, err)
+	assert.True(t, cold.IsActive("tag-3"))
+}
+
+func TestHTTPProvider_invalidPayload(t *testing.T) {
+	var mu sync.Mutex
+	payload, etag := snapshotPayload("tag-2"), `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", etag)
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	ct := newTestInstance(t, "http-provider-invalid")
+	ct.Register([]interface{}{"tag-1"})
+	provider := NewHTTPProvider(server.URL, ct)
+	_, err := provider.Fetch(context.Background())
+	assert.Nil(t, err)
+
+	for _, invalid := range []string{`{"schemaVersion": 99}`, `{`, `{"schemaVersion": 1, "overrides": [{"tag": ""}]}`} {
+		mu.Lock()
+		payload, etag = []byte(invalid), `"broken"`
+		mu.Unlock()
+		_, err = provider.Fetch(context.Background())
+		assert.NotNil(t, err)
+		// a bad payload leaves the manager and the ETag unchanged
+		assert.True(t, ct.IsActive("tag-1", "tag-2"))
+		assert.Equal(t, `"v1"`, provider.lastETag())
+	}
+}
+
+func TestHTTPProvider_run(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(snapshotPayload("tag-2"))
+	}))
+	defer server.Close()
+
+	ct := newTestInstance(t, "http-provider-run")
+	provider := NewHTTPProvider(server.URL, ct)
+	provider.Interval = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- provider.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return ct.IsActive("tag-2")
+	}, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, backoff(time.Second, time.Minute, 0))
+	assert.Equal(t, 2*time.Second, backoff(time.Second, time.Minute, 1))
+	assert.Equal(t, 8*time.Second, backoff(time.Second, time.Minute, 3))
+	assert.Equal(t, time.Minute, backoff(time.Second, time.Minute, 10))
+
+	delays := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		delay := jitter(8 * time.Second)
+		assert.True(t, delay >= 4*time.Second && delay <= 8*time.Second, delay)
+		delays[delay] = true
+	}
+	assert.True(t, len(delays) > 1)
+}
@@ -0,0 +1,138 @@
+package codetags
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Registry holds named managers. The package functions GetInstance and
+// NewInstance use a default registry, libraries and parallel tests can
+// create their own to keep their instances apart.
+type Registry struct {
+	mu        sync.Mutex
+	instances map[string]*TagManager
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{instances: make(map[string]*TagManager)}
+}
+
+var defaultRegistry = NewRegistry()
+
+// Get returns the instance with the name, it is created with the presets
+// when it does not exist yet.
+func (r *Registry) Get(name string, opts ...*Presets) (*TagManager, error) {
+	name = labelify(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if instance, ok := r.instances[name]; ok {
+		return instance, nil
+	}
+	return r.create(name, opts...)
+}
+
+// New creates the instance with the name, it fails when the name is already
+// used. Replace drops the existing instance instead.
+func (r *Registry) New(name string, opts ...*Presets) (*TagManager, error) {
+	name = labelify(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.instances[name]; ok {
+		if name == DEFAULT_NAMESPACE {
+			return nil, errDefaultInstance()
+		}
+		return nil, fmt.Errorf("Instance [%s] already exists", name)
+	}
+	return r.create(name, opts...)
+}
+
+func errDefaultInstance() error {
+	return fmt.Errorf(
+		"%s is default instance name. Please provides another name.",
+		DEFAULT_NAMESPACE)
+}
+
+// Replace creates the instance with the name, an existing instance with the
+// same name is removed from the registry but keeps working for its holders.
+// The default instance cannot be replaced, its holders would not see it.
+func (r *Registry) Replace(name string, opts ...*Presets) (*TagManager, error) {
+	name = labelify(name)
+	if name == DEFAULT_NAMESPACE {
+		return nil, errDefaultInstance()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(name, opts...)
+}
+
+// Remove deletes the instance with the name from the registry, it returns
+// false when there is no such instance. The default instance is never removed.
+func (r *Registry) Remove(name string) bool {
+	name = labelify(name)
+	if name == DEFAULT_NAMESPACE {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.instances[name]; !ok {
+		return false
+	}
+	delete(r.instances, name)
+	return true
+}
+
+// List returns the sorted names of the instances.
+func (r *Registry) List() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.instances))
+	for name := range r.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) lookup(name string) (*TagManager, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instance, ok := r.instances[labelify(name)]
+	return instance, ok
+}
+
+func (r *Registry) create(name string, opts ...*Presets) (*TagManager, error) {
+	if name == "" {
+		return nil, fmt.Errorf(
+			"The name of a codetags instance must be not empty")
+	}
+	var presets *Presets
+	if len(opts) > 0 {
+		presets = opts[0]
+	}
+	c := newTagManager()
+	c.initialize(presets)
+	if dotenv, ok := c.presets["dotenv"]; ok && len(dotenv) > 0 {
+		if err := c.LoadDotenv(dotenv); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if stateFile, ok := c.presets["stateFile"]; ok && len(stateFile) > 0 {
+		if err := c.SetOverrideStore(NewFileStore(stateFile)); err != nil {
+			return nil, err
+		}
+	}
+	if parentName, ok := c.presets["parent"]; ok && len(parentName) > 0 {
+		parent, ok := r.instances[labelify(parentName)]
+		if !ok {
+			return nil, fmt.Errorf("The parent instance [%s] is not found", parentName)
+		}
+		if err := c.SetParent(parent); err != nil {
+			return nil, err
+		}
+	}
+	r.instances[name] = c
+	return c, nil
+}
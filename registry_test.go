@@ -0,0 +1,72 @@
+package codetags
+
+import "net/http/httptest"
+import "os"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	assert.Empty(t, registry.List())
+
+	ct, err := registry.Get("my-module", &Presets{"namespace": "MyModule"})
+	assert.Nil(t, err)
+	same, _ := registry.Get("MY_MODULE")
+	assert.True(t, ct == same)
+	assert.Equal(t, "MYMODULE", same.GetPresets()["namespace"])
+
+	def, err := registry.Get(DEFAULT_NAMESPACE)
+	assert.Nil(t, err)
+	assert.False(t, def == Default())
+	_, err = registry.New(DEFAULT_NAMESPACE)
+	assert.NotNil(t, err)
+	_, err = registry.New("")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []string{"CODETAGS", "MY_MODULE"}, registry.List())
+	assert.True(t, registry.Remove("my-module"))
+	assert.False(t, registry.Remove("my-module"))
+	assert.Equal(t, []string{"CODETAGS"}, registry.List())
+}
+
+func TestRegistry_parallel(t *testing.T) {
+	for _, name := range []string{"first", "second"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			registry := NewRegistry()
+			ct, _ := registry.Get("module")
+			ct.Register([]interface{}{name})
+			assert.Equal(t, []string{name}, ct.GetDeclaredTags())
+		})
+	}
+}
+
+func TestDebugHandler_registry(t *testing.T) {
+	os.Setenv("DEBUGREGISTRY_INCLUDED_TAGS", "abc")
+	registry := NewRegistry()
+	ct, _ := registry.New("debug-registry", &Presets{"namespace": "DebugRegistry"})
+	ct.Register([]interface{}{"tag-1"})
+
+	handler := &DebugHandler{Registry: registry}
+	state := getDebugState(t, handler, "/debug/codetags/", "DEBUG_REGISTRY")
+	assert.Equal(t, []string{"tag-1"}, state.DeclaredTags)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/codetags/", nil))
+	assert.NotContains(t, recorder.Body.String(), `"name": "CODETAGS"`)
+}
+
+// newTestInstance creates an instance of the default registry which is
+// removed when the test ends, so the tests can run more than once.
+func newTestInstance(t *testing.T, name string, opts ...*Presets) *TagManager {
+	t.Helper()
+	ct, err := NewInstance(name, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		RemoveInstance(name)
+	})
+	return ct
+}
@@ -0,0 +1,141 @@
+package codetags
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// remoteLayer holds the tags set by a remote source, they are merged over the
+// included, excluded and declared tags of the manager; its declared tags
+// come last, after the ones of the manager.
+type remoteLayer struct {
+	declaredTags []string
+	includedTags []string
+	excludedTags []string
+	overrides    map[string]*override
+}
+
+func (l *remoteLayer) stop() {
+	for _, o := range l.overrides {
+		o.stop()
+	}
+}
+
+// SetRemote replaces the remote layer of the manager by the included tags,
+// the excluded tags and the overrides of the snapshot, and by the tags its
+// descriptors declare with the version preset of the snapshot; its other
+// presets are ignored. The remote included, excluded and overridden tags
+// come after the overrides and the command-line flags of the manager and
+// before its own excluded, included and declared tags, the remote declared
+// tags come after all of them. The remote layer survives Reset and is not
+// part of the snapshot of the manager. An invalid snapshot leaves the
+// manager unchanged.
+func (c *TagManager) SetRemote(snapshot *TagSnapshot) error {
+	if snapshot.SchemaVersion != SnapshotSchemaVersion {
+		return fmt.Errorf("Unsupported snapshot schema version %d, must be %d",
+			snapshot.SchemaVersion, SnapshotSchemaVersion)
+	}
+	// the descriptors are evaluated apart, without the environment of the
+	// process
+	declared := newTagManager()
+	declared.lookupEnv = func(string) (string, bool) { return "", false }
+	if version, ok := snapshot.Presets["version"]; ok {
+		declared.initialize(&Presets{"version": version})
+	} else {
+		declared.initialize(nil)
+	}
+	defs := make([]interface{}, 0, len(snapshot.Descriptors))
+	for _, descriptor := range snapshot.Descriptors {
+		defs = append(defs, descriptor.toTagDescriptor())
+	}
+	if errs := declared.register(defs); len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	layer := &remoteLayer{
+		declaredTags: declared.store.declaredTags,
+		includedTags: listClone(snapshot.IncludedTags),
+		excludedTags: listClone(snapshot.ExcludedTags),
+		overrides:    make(map[string]*override, len(snapshot.Overrides)),
+	}
+	for _, record := range snapshot.Overrides {
+		if len(record.Tag) == 0 {
+			return fmt.Errorf("The tag of a remote override must be not empty")
+		}
+	}
+	now := time.Now()
+	for _, record := range snapshot.Overrides {
+		if !record.ExpiresAt.IsZero() && !record.ExpiresAt.After(now) {
+			continue
+		}
+		layer.overrides[record.Tag] = &override{OverrideRecord: record}
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.remote != nil {
+		c.remote.stop()
+	}
+	c.remote = layer
+	// the timers start once the layer is in place, so an early expiry never
+	// runs against the previous one
+	for tag, o := range layer.overrides {
+		if !o.ExpiresAt.IsZero() {
+			c.expireRemote(tag, o, o.ExpiresAt.Sub(now))
+		}
+	}
+	for k := range c.store.cachedTags {
+		delete(c.store.cachedTags, k)
+	}
+	c.changed()
+	c.log("codetags: remote state applied", "declared", layer.declaredTags, "included", layer.includedTags,
+		"excluded", layer.excludedTags, "overrides", len(layer.overrides))
+	return nil
+}
+
+// expireRemote removes the remote override of the tag after the delay,
+// unless another layer or override replaced it meanwhile.
+func (c *TagManager) expireRemote(tag string, o *override, delay time.Duration) {
+	o.timer = time.AfterFunc(delay, func() {
+		c.mu.Lock()
+		defer c.unlock()
+		if c.remote != nil && c.remote.overrides[tag] == o {
+			delete(c.remote.overrides, tag)
+			delete(c.store.cachedTags, tag)
+			c.changed()
+		}
+	})
+}
+
+// ClearRemote removes the remote layer of the manager.
+func (c *TagManager) ClearRemote() *TagManager {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.remote != nil {
+		c.remote.stop()
+		c.remote = nil
+		for k := range c.store.cachedTags {
+			delete(c.store.cachedTags, k)
+		}
+		c.changed()
+	}
+	return c
+}
+
+// remoteLabelState evaluates a tag with the remote layer, ok is false when
+// it does not decide.
+func (c *TagManager) remoteLabelState(label string) (active bool, ok bool) {
+	if c.remote == nil {
+		return false, false
+	}
+	if o, ok := c.remote.overrides[label]; ok {
+		return o.Enabled, true
+	}
+	if listContains(c.remote.excludedTags, label) {
+		return false, true
+	}
+	if listContains(c.remote.includedTags, label) {
+		return true, true
+	}
+	return false, false
+}
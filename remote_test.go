@@ -0,0 +1,82 @@
+package codetags
+
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func TestSetRemote(t *testing.T) {
+	ct := newTagManager()
+	ct.SetEnvLookup(func(key string) (string, bool) {
+		switch key {
+		case "CODETAGS_INCLUDED_TAGS":
+			return "env-1", true
+		case "CODETAGS_EXCLUDED_TAGS":
+			return "tag-2", true
+		}
+		return "", false
+	})
+	ct.Register([]interface{}{"tag-1", "tag-2", "tag-3"})
+	ct.Override("tag-4", false)
+
+	assert.Nil(t, ct.SetRemote(&TagSnapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Presets:       Presets{"namespace": "REMOTE", "version": "9.0.0"},
+		Descriptors: []DescriptorSnapshot{
+			{Name: "remote-1"},
+			{Name: "remote-3", Plan: &PlanSnapshot{Enabled: Bool(true), MinBound: "10.0.0"}},
+			{Name: "tag-3"},
+		},
+		IncludedTags: []string{"tag-2", "remote-2"},
+		ExcludedTags: []string{"tag-3"},
+		Overrides: []OverrideRecord{
+			{Tag: "tag-1", Enabled: false},
+			{Tag: "tag-4", Enabled: true},
+			{Tag: "tag-5", Enabled: true, ExpiresAt: time.Now().Add(20 * time.Millisecond)},
+			{Tag: "tag-6", Enabled: true, ExpiresAt: time.Now().Add(-time.Second)},
+		},
+	}))
+	// the local declarations and presets are kept
+	assert.Equal(t, []string{"tag-1", "tag-2", "tag-3"}, ct.GetDeclaredTags())
+	assert.Equal(t, "", ct.GetPresets()["version"])
+	assert.False(t, ct.IsActive("tag-1"))
+	assert.True(t, ct.IsActive("tag-2"))
+	assert.False(t, ct.IsActive("tag-3"))
+	// the local overrides come first
+	assert.False(t, ct.IsActive("tag-4"))
+	assert.True(t, ct.IsActive("tag-5"))
+	assert.False(t, ct.IsActive("tag-6"))
+	assert.True(t, ct.IsActive("env-1", "remote-2"))
+	// the tags declared by the remote source come after the local ones
+	assert.True(t, ct.IsActive("remote-1"))
+	assert.False(t, ct.IsActive("remote-3"))
+	assert.Eventually(t, func() bool {
+		return !ct.IsActive("tag-5")
+	}, time.Second, 5*time.Millisecond)
+
+	assert.NotNil(t, ct.SetRemote(&TagSnapshot{SchemaVersion: 2, ExcludedTags: []string{"env-1"}}))
+	assert.True(t, ct.IsActive("remote-2"))
+
+	ct.ClearRemote()
+	assert.False(t, ct.IsActive("remote-1"))
+	assert.True(t, ct.IsActive("tag-1"))
+	assert.False(t, ct.IsActive("tag-2"))
+	assert.False(t, ct.IsActive("remote-2"))
+}
+
+func TestSetRemote_expiry(t *testing.T) {
+	ct := newTagManager()
+	changes := make(chan struct{}, 10)
+	ct.watch(func() { changes <- struct{}{} })
+
+	assert.Nil(t, ct.SetRemote(&TagSnapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Overrides:     []OverrideRecord{{Tag: "tag-1", Enabled: true, ExpiresAt: time.Now().Add(time.Millisecond)}},
+	}))
+	<-changes
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("the expiry of the remote override is not notified")
+	}
+	assert.False(t, ct.IsActive("tag-1"))
+}
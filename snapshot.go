@@ -0,0 +1,203 @@
+package codetags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SnapshotSchemaVersion is the version of the TagSnapshot JSON schema
+// written by Export.
+const SnapshotSchemaVersion = 1
+
+// TagSnapshot is the full state of a manager: the presets, the registered
+// descriptors, the included and excluded tags read from the environment and
+// the runtime overrides. The presets naming files or instances of the host,
+// stateFile, dotenv and parent, are left out.
+type TagSnapshot struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	Presets       Presets              `json:"presets"`
+	Descriptors   []DescriptorSnapshot `json:"descriptors"`
+	IncludedTags  []string             `json:"includedTags"`
+	ExcludedTags  []string             `json:"excludedTags"`
+	Overrides     []OverrideRecord     `json:"overrides"`
+}
+
+// DescriptorSnapshot is the JSON representation of a TagDescriptor, the
+// values that Register ignores are not kept.
+type DescriptorSnapshot struct {
+	Name    string        `json:"name"`
+	Enabled *bool         `json:"enabled,omitempty"`
+	Plan    *PlanSnapshot `json:"plan,omitempty"`
+	Note    string        `json:"note,omitempty"`
+}
+
+// PlanSnapshot is the JSON representation of a TagPlan.
+type PlanSnapshot struct {
+	Enabled  *bool  `json:"enabled,omitempty"`
+	MinBound string `json:"minBound,omitempty"`
+	MaxBound string `json:"maxBound,omitempty"`
+}
+
+func newDescriptorSnapshot(info TagDescriptor) DescriptorSnapshot {
+	descriptor := DescriptorSnapshot{Name: info.Name, Note: info.Note}
+	if enabled, ok := info.Enabled.(bool); ok {
+		descriptor.Enabled = Bool(enabled)
+	}
+	if plan, ok := info.Plan.(TagPlan); ok {
+		descriptor.Plan = &PlanSnapshot{}
+		if enabled, ok := plan.Enabled.(bool); ok {
+			descriptor.Plan.Enabled = Bool(enabled)
+		}
+		if minBound, ok := plan.MinBound.(string); ok {
+			descriptor.Plan.MinBound = minBound
+		}
+		if maxBound, ok := plan.MaxBound.(string); ok {
+			descriptor.Plan.MaxBound = maxBound
+		}
+	}
+	return descriptor
+}
+
+func (d DescriptorSnapshot) toTagDescriptor() TagDescriptor {
+	info := TagDescriptor{Name: d.Name, Note: d.Note}
+	if d.Enabled != nil {
+		info.Enabled = *d.Enabled
+	}
+	if d.Plan != nil {
+		plan := TagPlan{}
+		if d.Plan.Enabled != nil {
+			plan.Enabled = *d.Plan.Enabled
+		}
+		if len(d.Plan.MinBound) > 0 {
+			plan.MinBound = d.Plan.MinBound
+		}
+		if len(d.Plan.MaxBound) > 0 {
+			plan.MaxBound = d.Plan.MaxBound
+		}
+		info.Plan = plan
+	}
+	return info
+}
+
+// Snapshot returns the current state of the manager.
+func (c *TagManager) Snapshot() *TagSnapshot {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.snapshot()
+}
+
+func (c *TagManager) snapshot() *TagSnapshot {
+	snapshot := &TagSnapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Presets:       Presets{},
+		Descriptors:   make([]DescriptorSnapshot, 0, len(c.store.descriptors)),
+		IncludedTags:  listClone(c.store.includedTags),
+		ExcludedTags:  listClone(c.store.excludedTags),
+		Overrides:     c.getOverrideRecords(),
+	}
+	for k, v := range c.presets {
+		if !listContains(hostPresets, k) {
+			snapshot.Presets[k] = v
+		}
+	}
+	names := []string{}
+	for _, info := range c.store.descriptors {
+		if !listContains(names, info.Name) {
+			names = append(names, info.Name)
+			snapshot.Descriptors = append(snapshot.Descriptors, newDescriptorSnapshot(info))
+		}
+	}
+	return snapshot
+}
+
+// Export encodes the state of the manager as a TagSnapshot JSON document.
+func (c *TagManager) Export() ([]byte, error) {
+	return json.MarshalIndent(c.Snapshot(), "", "  ")
+}
+
+// Import replaces the state of the manager by a document written by Export.
+func (c *TagManager) Import(data []byte) error {
+	snapshot := &TagSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return err
+	}
+	return c.Restore(snapshot)
+}
+
+// hostPresets name files and instances of the host, they are not part of a
+// snapshot and a restore keeps them.
+var hostPresets = []string{"stateFile", "parent", "dotenv"}
+
+// Restore replaces the presets, the descriptors, the included and excluded
+// tags and the overrides of the manager by the snapshot; the variants, the
+// experiments, the usage and the override store are kept. The included and
+// excluded tags of the snapshot are pinned, the environment variables of the
+// process are ignored until the next Reset. An invalid snapshot leaves the
+// manager unchanged.
+func (c *TagManager) Restore(snapshot *TagSnapshot) error {
+	if snapshot.SchemaVersion != SnapshotSchemaVersion {
+		return fmt.Errorf("Unsupported snapshot schema version %d, must be %d",
+			snapshot.SchemaVersion, SnapshotSchemaVersion)
+	}
+	// the new state is built apart and swapped in once it is valid
+	restored := newTagManager()
+	presets := Presets{}
+	for k, v := range snapshot.Presets {
+		if !listContains(hostPresets, k) {
+			presets[k] = v
+		}
+	}
+	restored.initialize(&presets)
+	defs := make([]interface{}, 0, len(snapshot.Descriptors))
+	for _, descriptor := range snapshot.Descriptors {
+		defs = append(defs, descriptor.toTagDescriptor())
+	}
+	if errs := restored.register(defs); len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	c.mu.Lock()
+	pending := c.restore(restored, snapshot)
+	c.unlock()
+	c.save(pending)
+	return nil
+}
+
+func (c *TagManager) restore(restored *TagManager, snapshot *TagSnapshot) *pendingSave {
+	for _, k := range hostPresets {
+		if v, ok := c.presets[k]; ok {
+			restored.presets[k] = v
+		}
+	}
+	c.presets = restored.presets
+	c.store.declaredTags = restored.store.declaredTags
+	c.store.descriptors = restored.store.descriptors
+	for k := range c.store.pinnedEnv {
+		delete(c.store.pinnedEnv, k)
+	}
+	c.store.pinnedEnv[c.getLabel("includedTags")] = listClone(snapshot.IncludedTags)
+	c.store.pinnedEnv[c.getLabel("excludedTags")] = listClone(snapshot.ExcludedTags)
+	for k, o := range c.store.overrides {
+		o.stop()
+		delete(c.store.overrides, k)
+	}
+	for _, record := range snapshot.Overrides {
+		c.applyOverride(record)
+	}
+	c.clearCache()
+	c.log("codetags: snapshot restored", "presets", c.presets, "declared", c.store.declaredTags)
+	return c.prepareSave()
+}
+
+// PreviewVersion returns the snapshot of the manager as it would be with the
+// version preset set to version, the presets of the manager are unchanged.
+// Diff of the current snapshot and the preview lists the tags whose plans
+// turn them on or off with that release.
+func (c *TagManager) PreviewVersion(version string) *TagSnapshot {
+	c.mu.Lock()
+	defer c.unlock()
+	snapshot := c.snapshot()
+	snapshot.Presets["version"] = version
+	return snapshot
+}
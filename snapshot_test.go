@@ -0,0 +1,137 @@
+package codetags
+
+import "encoding/json"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func TestExportImport(t *testing.T) {
+	os.Setenv("EXPORT_INCLUDED_TAGS", "abc,tag-2")
+	os.Setenv("EXPORT_EXCLUDED_TAGS", "tag-1")
+
+	source := newTestInstance(t, "export", &Presets{"namespace": "Export", "version": "1.5.0"})
+	source.Register([]interface{}{
+		"tag-1",
+		TagDescriptor{Name: "tag-2", Enabled: false, Note: "the new checkout"},
+		TagDescriptor{Name: "tag-3", Plan: TagPlan{Enabled: true, MinBound: "1.0.0", MaxBound: "2.0.0"}},
+	})
+	source.ApplyOverride(OverrideRecord{Tag: "tag-4", Enabled: true, Author: "ops", Reason: "canary",
+		ExpiresAt: time.Now().Add(time.Hour)})
+
+	data, err := source.Export()
+	assert.Nil(t, err)
+
+	snapshot := TagSnapshot{}
+	assert.Nil(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, SnapshotSchemaVersion, snapshot.SchemaVersion)
+	assert.Equal(t, Presets{"namespace": "EXPORT", "version": "1.5.0"}, snapshot.Presets)
+	assert.Equal(t, []DescriptorSnapshot{
+		{Name: "tag-1"},
+		{Name: "tag-2", Enabled: Bool(false), Note: "the new checkout"},
+		{Name: "tag-3", Plan: &PlanSnapshot{Enabled: Bool(true), MinBound: "1.0.0", MaxBound: "2.0.0"}},
+	}, snapshot.Descriptors)
+	assert.Equal(t, []string{"abc", "tag-2"}, snapshot.IncludedTags)
+	assert.Equal(t, []string{"tag-1"}, snapshot.ExcludedTags)
+	assert.Equal(t, 1, len(snapshot.Overrides))
+	assert.Equal(t, "ops", snapshot.Overrides[0].Author)
+
+	// the environment of the target process is ignored
+	os.Setenv("EXPORT_EXCLUDED_TAGS", "abc")
+	target := newTestInstance(t, "import")
+	target.Register([]interface{}{"xyz"})
+	assert.Nil(t, target.Import(data))
+
+	for _, tag := range []string{"tag-1", "tag-2", "tag-3", "tag-4", "abc", "xyz"} {
+		assert.Equal(t, source.IsActive(tag), target.IsActive(tag), tag)
+	}
+	assert.False(t, target.IsActive("tag-1"))
+	assert.True(t, target.IsActive("tag-2"))
+	assert.True(t, target.IsActive("tag-3"))
+	assert.True(t, target.IsActive("tag-4"))
+	assert.True(t, target.IsActive("abc"))
+
+	target.ClearCache()
+	assert.True(t, target.IsActive("abc"))
+	exported, err := target.Export()
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(data), string(exported))
+
+	// the pinned tags are released by Reset
+	target.Reset().Initialize(&Presets{"namespace": "Export"})
+	assert.False(t, target.IsActive("abc"))
+}
+
+func TestImport_invalid(t *testing.T) {
+	ct := newTestInstance(t, "import-invalid", &Presets{"version": "1.0.0"})
+	ct.Register([]interface{}{"tag-1"})
+	ct.Override("tag-2", true)
+	before, err := ct.Export()
+	assert.Nil(t, err)
+
+	assert.NotNil(t, ct.Import([]byte("{")))
+	assert.NotNil(t, ct.Import([]byte(`{"schemaVersion": 2}`)))
+	assert.NotNil(t, ct.Import([]byte(`{"schemaVersion": 1, "presets": {"version": "2.0.0"},
+		"descriptors": [{"name": "tag-3"}, {"name": "tag-3"}]}`)))
+
+	// a failed import leaves the manager unchanged
+	after, err := ct.Export()
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(before), string(after))
+	assert.True(t, ct.IsActive("tag-1", "tag-2"))
+}
+
+func TestImport_keepsHostState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	ct := newTestInstance(t, "import-host", &Presets{"stateFile": path, "dotenv": filepath.Join(dir, ".env")})
+	ct.RegisterVariants(VariantDescriptor{Name: "checkout", Default: "v1", Variants: map[string]interface{}{"v1": 1}})
+	ct.Register([]interface{}{"tag-1"})
+	ct.IsActive("tag-1")
+
+	data, err := ct.Export()
+	assert.Nil(t, err)
+	snapshot := TagSnapshot{}
+	assert.Nil(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, Presets{}, snapshot.Presets)
+
+	snapshot.Presets = Presets{"version": "1.0.0", "stateFile": "/elsewhere.json"}
+	snapshot.Overrides = []OverrideRecord{{Tag: "tag-1", Enabled: false}}
+	assert.Nil(t, ct.Restore(&snapshot))
+
+	presets := ct.GetPresets()
+	assert.Equal(t, path, presets["stateFile"])
+	assert.Equal(t, filepath.Join(dir, ".env"), presets["dotenv"])
+	assert.Equal(t, "1.0.0", presets["version"])
+	assert.Equal(t, "v1", ct.GetVariant("checkout"))
+	assert.Equal(t, uint64(1), ct.GetUsageReport().Declared[0].Count)
+	// the restored overrides are saved into the store of the manager
+	records, err := NewFileStore(path).Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "tag-1", records[0].Tag)
+}
+
+func TestPreviewVersion(t *testing.T) {
+	ct := newTestInstance(t, "preview-version", &Presets{"namespace": "PreviewVersion", "version": "1.0.0"})
+	ct.Register([]interface{}{
+		"tag-1",
+		TagDescriptor{Name: "tag-2", Plan: TagPlan{Enabled: true, MinBound: "2.0.0"}},
+		TagDescriptor{Name: "tag-3", Plan: TagPlan{Enabled: false, MinBound: "1.5.0"}},
+		TagDescriptor{Name: "tag-4", Plan: TagPlan{Enabled: true, MinBound: "3.0.0"}},
+	})
+
+	preview := ct.PreviewVersion("2.0.0")
+	assert.Equal(t, "2.0.0", preview.Presets["version"])
+	assert.Equal(t, "1.0.0", ct.GetPresets()["version"])
+	assert.True(t, ct.IsActive("tag-3"))
+	assert.False(t, ct.IsActive("tag-2"))
+
+	changes, err := Diff(ct.Snapshot(), preview)
+	assert.Nil(t, err)
+	assert.Equal(t, []TagChange{
+		{Tag: "tag-2", Before: false, After: true, Reasons: []string{"plan bound crossed: version 1.0.0 -> 2.0.0"}},
+		{Tag: "tag-3", Before: true, After: false, Reasons: []string{"plan bound crossed: version 1.0.0 -> 2.0.0"}},
+	}, changes)
+}
@@ -0,0 +1,117 @@
+package codetags
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OverrideStore persists the runtime overrides of a manager.
+type OverrideStore interface {
+	Load() ([]OverrideRecord, error)
+	Save(records []OverrideRecord) error
+}
+
+// ErrCorruptedStateFile is returned by FileStore.Load when the content of
+// the file does not match its checksum or could not be decoded.
+var ErrCorruptedStateFile = errors.New("The codetags state file is corrupted")
+
+// FileStore saves the overrides into a local JSON file. The file is
+// replaced atomically and carries a checksum of the records.
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore creates a store for the file at path, the file is created on
+// the first save.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+const stateFileVersion = 1
+
+type stateFile struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Records  json.RawMessage `json:"records"`
+}
+
+// Load reads the records, a missing file has no record.
+func (s *FileStore) Load() ([]OverrideRecord, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return []OverrideRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := stateFile{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptedStateFile, s.Path, err)
+	}
+	if state.Version != stateFileVersion {
+		return nil, fmt.Errorf("The codetags state file %s has unsupported version %d", s.Path, state.Version)
+	}
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, state.Records); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptedStateFile, s.Path, err)
+	}
+	if checksumOf(compacted.Bytes()) != state.Checksum {
+		return nil, fmt.Errorf("%w: %s: checksum mismatch", ErrCorruptedStateFile, s.Path)
+	}
+	records := []OverrideRecord{}
+	if err := json.Unmarshal(state.Records, &records); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptedStateFile, s.Path, err)
+	}
+	return records, nil
+}
+
+// Save writes the records into a temporary file which then replaces the
+// state file, so a crash never leaves a partially written file.
+func (s *FileStore) Save(records []OverrideRecord) error {
+	recordsData, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stateFile{
+		Version:  stateFileVersion,
+		Checksum: checksumOf(recordsData),
+		Records:  recordsData,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data)
+}
+
+// writeFileAtomic writes the data into a temporary file which then replaces
+// the file at path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
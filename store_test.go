@@ -0,0 +1,144 @@
+package codetags
+
+import "errors"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewFileStore(path)
+
+	records, err := store.Load()
+	assert.Nil(t, err)
+	assert.Empty(t, records)
+
+	createdAt := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	saved := []OverrideRecord{
+		{Tag: "tag-1", Enabled: true, Author: "alice", Reason: "incident #42", CreatedAt: createdAt},
+		{Tag: "tag-2", Enabled: false, CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour)},
+	}
+	assert.Nil(t, store.Save(saved))
+	records, err = store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, saved, records)
+
+	matches, _ := filepath.Glob(path + ".tmp*")
+	assert.Empty(t, matches)
+}
+
+func TestFileStore_corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewFileStore(path)
+	assert.Nil(t, store.Save([]OverrideRecord{{Tag: "tag-1", Enabled: true}}))
+
+	data, _ := os.ReadFile(path)
+	tampered := []byte(string(data[:len(data)/2]))
+	assert.Nil(t, os.WriteFile(path, tampered, 0644))
+	_, err := store.Load()
+	assert.True(t, errors.Is(err, ErrCorruptedStateFile))
+
+	assert.Nil(t, os.WriteFile(path, []byte(`{"version":1,"checksum":"abc","records":[{"tag":"tag-1","enabled":false}]}`), 0644))
+	_, err = store.Load()
+	assert.True(t, errors.Is(err, ErrCorruptedStateFile))
+
+	_, err = NewInstance("state-file-corrupted", &Presets{"stateFile": path})
+	assert.True(t, errors.Is(err, ErrCorruptedStateFile))
+}
+
+func TestOverrideStore_restore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	ct := newTestInstance(t, "state-file", &Presets{"stateFile": path})
+	ct.Register([]interface{}{"tag-1", "tag-2"})
+	assert.Nil(t, ct.ApplyOverride(OverrideRecord{Tag: "tag-1", Enabled: false, Author: "bob", Reason: "rollback"}))
+	ct.Override("tag-3", true)
+	ct.Override("tag-4", true, time.Hour)
+	ct.RemoveOverride("tag-3")
+
+	restored := newTestInstance(t, "state-file-restored", &Presets{"stateFile": path})
+	restored.Register([]interface{}{"tag-1", "tag-2"})
+	assert.Equal(t, map[string]bool{"tag-1": false, "tag-4": true}, restored.Overrides())
+	assert.False(t, restored.IsActive("tag-1"))
+	records := restored.OverrideRecords()
+	assert.Equal(t, "bob", records[0].Author)
+	assert.Equal(t, "rollback", records[0].Reason)
+	assert.False(t, records[0].CreatedAt.IsZero())
+	assert.False(t, records[1].ExpiresAt.IsZero())
+}
+
+func TestOverrideStore_expired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	past := time.Now().Add(-time.Hour)
+	assert.Nil(t, NewFileStore(path).Save([]OverrideRecord{
+		{Tag: "tag-1", Enabled: false, CreatedAt: past.Add(-time.Hour), ExpiresAt: past},
+		{Tag: "tag-2", Enabled: true, CreatedAt: past},
+	}))
+
+	ct := newTestInstance(t, "state-file-expired", &Presets{"stateFile": path})
+	assert.Equal(t, map[string]bool{"tag-2": true}, ct.Overrides())
+}
+
+type failingStore struct {
+	manager *TagManager
+	locked  bool
+}
+
+func (s *failingStore) Load() ([]OverrideRecord, error) {
+	return []OverrideRecord{}, nil
+}
+
+func (s *failingStore) Save(records []OverrideRecord) error {
+	if s.manager.mu.TryLock() {
+		s.manager.mu.Unlock()
+	} else {
+		s.locked = true
+	}
+	return errors.New("disk full")
+}
+
+func TestOverrideStore_saveError(t *testing.T) {
+	ct := newTagManager()
+	store := &failingStore{manager: ct}
+	assert.Nil(t, ct.SetOverrideStore(store))
+
+	err := ct.ApplyOverride(OverrideRecord{Tag: "tag-1", Enabled: false})
+	assert.EqualError(t, err, "disk full")
+	// the override is applied anyway
+	assert.False(t, ct.IsActive("tag-1"))
+	assert.EqualError(t, ct.LastSaveError(), "disk full")
+	ct.RemoveOverride("tag-1")
+	assert.EqualError(t, ct.LastSaveError(), "disk full")
+	// the manager is not locked during the save
+	assert.False(t, store.locked)
+
+	assert.Nil(t, ct.SetOverrideStore(NewFileStore(filepath.Join(t.TempDir(), "state.json"))))
+	ct.Override("tag-1", true)
+	assert.Nil(t, ct.LastSaveError())
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Load() ([]OverrideRecord, error) {
+	return nil, ErrCorruptedStateFile
+}
+
+func (brokenStore) Save(records []OverrideRecord) error {
+	return nil
+}
+
+func TestOverrideStore_loadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	ct := newTagManager()
+	assert.Nil(t, ct.SetOverrideStore(NewFileStore(path)))
+
+	assert.True(t, errors.Is(ct.SetOverrideStore(brokenStore{}), ErrCorruptedStateFile))
+	// the current store stays attached
+	ct.Override("tag-1", false)
+	records, err := NewFileStore(path).Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "tag-1", records[0].Tag)
+}
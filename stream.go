@@ -0,0 +1,351 @@
+package codetags
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SnapshotServer serves the snapshot of a manager to other processes: a GET
+// returns it with an ETag for HTTPProvider, a GET accepting
+// text/event-stream streams it as server-sent events for StreamProvider,
+// one "snapshot" event on each change. The event ids are the ETags, so a
+// client resumes with Last-Event-ID without receiving the state it already
+// has. The presets naming the environment variables of the host are not
+// published.
+type SnapshotServer struct {
+	// Heartbeat is the interval of the comments keeping the streams open,
+	// 15 seconds when zero.
+	Heartbeat time.Duration
+	// Authorize, when set, refuses the requests for which it returns false.
+	Authorize func(r *http.Request) bool
+
+	manager     *TagManager
+	publishMu   sync.Mutex
+	mu          sync.Mutex
+	etag        string
+	data        []byte
+	subscribers map[chan struct{}]struct{}
+	pending     bool
+	publishing  bool
+	unwatch     func()
+	closeOnce   sync.Once
+	closed      chan struct{}
+}
+
+// NewSnapshotServer creates the server and publishes the current state of
+// the manager, every later change of the overrides, the declared tags or
+// the environment of the manager is published on its own until Close.
+func NewSnapshotServer(c *TagManager) (*SnapshotServer, error) {
+	s := &SnapshotServer{
+		manager:     c,
+		subscribers: make(map[chan struct{}]struct{}),
+		closed:      make(chan struct{}),
+	}
+	if err := s.Publish(); err != nil {
+		return nil, err
+	}
+	s.unwatch = c.watch(s.schedule)
+	return s, nil
+}
+
+// Close stops following the changes of the manager and ends the open
+// streams, the server keeps serving the last published snapshot.
+func (s *SnapshotServer) Close() error {
+	// the watchers run with the lock of the manager held, so it is not taken
+	// under the lock of the server
+	s.closeOnce.Do(func() {
+		s.unwatch()
+		close(s.closed)
+	})
+	return nil
+}
+
+// Publish exports the manager and notifies the streams when the snapshot
+// changed. The changes of the manager are published without calling it.
+func (s *SnapshotServer) Publish() error {
+	// the export and the swap go together, the last publish wins with the
+	// latest state
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+	snapshot := s.manager.Snapshot()
+	for _, k := range []string{"namespace", "INCLUDED_TAGS", "EXCLUDED_TAGS"} {
+		delete(snapshot.Presets, k)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	etag := `"` + checksumOf(data)[:16] + `"`
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if etag == s.etag {
+		return nil
+	}
+	s.etag, s.data = etag, data
+	for ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// schedule publishes the manager after a change, the lock of the manager is
+// held so the publish runs in another goroutine; the changes made while it
+// runs are published together by its next round.
+func (s *SnapshotServer) schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = true
+	if s.publishing {
+		return
+	}
+	s.publishing = true
+	go func() {
+		for {
+			s.mu.Lock()
+			if !s.pending {
+				s.publishing = false
+				s.mu.Unlock()
+				return
+			}
+			s.pending = false
+			s.mu.Unlock()
+			if err := s.Publish(); err != nil {
+				s.manager.mu.Lock()
+				s.manager.warn("codetags: snapshot is not published", "error", err)
+				s.manager.unlock()
+			}
+		}
+	}()
+}
+
+func (s *SnapshotServer) current() (string, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.etag, s.data
+}
+
+func (s *SnapshotServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Authorize != nil && !s.Authorize(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.serveStream(w, r)
+		return
+	}
+	etag, data := s.current()
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+func (s *SnapshotServer) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusNotImplemented)
+		return
+	}
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := s.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	sent := r.Header.Get("Last-Event-ID")
+	for {
+		if etag, data := s.current(); etag != sent {
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: snapshot\ndata: %s\n\n", etag, data); err != nil {
+				return
+			}
+			flusher.Flush()
+			sent = etag
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		case <-ch:
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// StreamProvider keeps the remote layer of a manager in line with a
+// SnapshotServer through its stream of server-sent events, each snapshot is
+// applied by SetRemote as soon as it is received. After a disconnection, it
+// polls once with Poller then connects again with the id of the last
+// applied snapshot in Last-Event-ID, the delay doubles from RetryDelay on
+// each failure with a random jitter.
+type StreamProvider struct {
+	// URL of the stream endpoint.
+	URL string
+	// Client sends the requests, nil uses http.DefaultClient. Its Timeout
+	// must be zero, it would cut the stream.
+	Client *http.Client
+	// RetryDelay before connecting again, 1 second when zero.
+	RetryDelay time.Duration
+	// MaxBackoff bounds the delay between the connections, 1 minute when
+	// zero.
+	MaxBackoff time.Duration
+	// Poller applies the snapshots and polls while the stream is down, it
+	// holds the ETag of the last applied snapshot and its disk cache.
+	Poller *HTTPProvider
+}
+
+// NewStreamProvider creates a provider of the stream at url for the manager,
+// the poller uses the same url.
+func NewStreamProvider(url string, c *TagManager) *StreamProvider {
+	return &StreamProvider{URL: url, Poller: NewHTTPProvider(url, c)}
+}
+
+// Run loads the cached payload then follows the stream until ctx is done.
+func (p *StreamProvider) Run(ctx context.Context) error {
+	if err := p.Poller.LoadCache(); err != nil && !os.IsNotExist(err) {
+		p.Poller.warn("codetags: provider cache is not loaded", err)
+	}
+	failures := 0
+	for {
+		err := p.stream(ctx, func() {
+			failures = 0
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.Poller.warn("codetags: stream disconnected", err)
+		if _, err := p.Poller.Fetch(ctx); err != nil && ctx.Err() == nil {
+			p.Poller.warn("codetags: provider fetch failed", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jitter(backoff(p.retryDelay(), p.maxBackoff(), failures))):
+		}
+		failures++
+	}
+}
+
+// stream reads the events until the connection ends, connected is called
+// once the server accepted the stream.
+func (p *StreamProvider) stream(ctx context.Context, connected func()) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if etag := p.Poller.lastETag(); len(etag) > 0 {
+		req.Header.Set("Last-Event-ID", etag)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected status [%s] from %s", resp.Status, p.URL)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		return fmt.Errorf("Unexpected content type [%s] from %s", resp.Header.Get("Content-Type"), p.URL)
+	}
+	connected()
+
+	// as in the SSE spec, an event without an id keeps the last one
+	reader := bufio.NewReader(resp.Body)
+	id, event, data := p.Poller.lastETag(), "", []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if len(data) > 0 && (event == "" || event == "snapshot") {
+				if err := p.Poller.apply(id, []byte(strings.Join(data, "\n"))); err != nil {
+					p.Poller.warn("codetags: stream snapshot is not applied", err)
+				}
+			}
+			event, data = "", data[:0]
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value := line, ""
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			field, value = line[:idx], strings.TrimPrefix(line[idx+1:], " ")
+		}
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
+
+func (p *StreamProvider) retryDelay() time.Duration {
+	if p.RetryDelay > 0 {
+		return p.RetryDelay
+	}
+	return time.Second
+}
+
+func (p *StreamProvider) maxBackoff() time.Duration {
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+	return time.Minute
+}
+
+func (p *HTTPProvider) lastETag() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.etag
+}
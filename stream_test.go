@@ -0,0 +1,239 @@
+package codetags
+
+import "context"
+import "encoding/json"
+import "io"
+import "net/http"
+import "net/http/httptest"
+import "strings"
+import "sync"
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func TestSnapshotServer_get(t *testing.T) {
+	source := newTestInstance(t, "snapshot-server", &Presets{"namespace": "SnapshotServer"})
+	source.Register([]interface{}{"tag-1"})
+	server, err := NewSnapshotServer(source)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/tags", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	etag := recorder.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	target := newTagManager()
+	assert.Nil(t, target.Import(recorder.Body.Bytes()))
+	assert.True(t, target.IsActive("tag-1"))
+
+	request := httptest.NewRequest("GET", "/tags", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	// an unchanged manager keeps its ETag
+	assert.Nil(t, server.Publish())
+	current, _ := server.current()
+	assert.Equal(t, etag, current)
+	// a change is published without calling Publish
+	source.Override("tag-1", false)
+	assert.Eventually(t, func() bool {
+		current, _ := server.current()
+		return current != etag
+	}, 2*time.Second, 5*time.Millisecond)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+	// the presets naming the environment of the host are not published
+	snapshot := TagSnapshot{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot))
+	assert.Equal(t, Presets{}, snapshot.Presets)
+
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("POST", "/tags", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestStreamProvider(t *testing.T) {
+	source := newTestInstance(t, "stream-source", &Presets{"namespace": "StreamSource"})
+	source.Register([]interface{}{"tag-1", "source-1"})
+	snapshots, _ := NewSnapshotServer(source)
+	var mu sync.Mutex
+	lastEventIDs := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			mu.Lock()
+			lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+			mu.Unlock()
+		}
+		snapshots.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ct := newTestInstance(t, "stream-provider")
+	ct.Register([]interface{}{"tag-1", "local-1"})
+	provider := NewStreamProvider(server.URL, ct)
+	provider.RetryDelay = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- provider.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return ct.IsActive("tag-1")
+	}, 2*time.Second, 5*time.Millisecond)
+	// a tag that only the source declares
+	assert.True(t, ct.IsActive("source-1"))
+
+	// the kill switch is applied without polling
+	source.Override("tag-1", false)
+	assert.Eventually(t, func() bool {
+		return !ct.IsActive("tag-1")
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// the provider resumes after a disconnection
+	server.CloseClientConnections()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lastEventIDs) >= 2
+	}, 2*time.Second, 5*time.Millisecond)
+	etag, _ := snapshots.current()
+	mu.Lock()
+	assert.Equal(t, "", lastEventIDs[0])
+	assert.Equal(t, etag, lastEventIDs[1])
+	mu.Unlock()
+
+	source.Override("tag-2", true)
+	assert.Eventually(t, func() bool {
+		return ct.IsActive("tag-2")
+	}, 2*time.Second, 5*time.Millisecond)
+	// the streamed snapshots do not replace the local declarations
+	assert.Equal(t, []string{"tag-1", "local-1"}, ct.GetDeclaredTags())
+	assert.True(t, ct.IsActive("local-1"))
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestStreamProvider_fallback(t *testing.T) {
+	source := newTestInstance(t, "stream-fallback-source", &Presets{"namespace": "StreamFallback"})
+	source.Register([]interface{}{"tag-1"})
+	snapshots, _ := NewSnapshotServer(source)
+	// a server without the stream endpoint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			http.NotFound(w, r)
+			return
+		}
+		snapshots.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ct := newTestInstance(t, "stream-fallback")
+	ct.Register([]interface{}{"tag-1"})
+	provider := NewStreamProvider(server.URL, ct)
+	provider.RetryDelay = 5 * time.Millisecond
+	provider.MaxBackoff = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- provider.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return ct.IsActive("tag-1")
+	}, 2*time.Second, 5*time.Millisecond)
+	source.Override("tag-1", false)
+	assert.Eventually(t, func() bool {
+		return !ct.IsActive("tag-1")
+	}, 2*time.Second, 5*time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestSnapshotServer_authorize(t *testing.T) {
+	server, err := NewSnapshotServer(newTagManager())
+	assert.Nil(t, err)
+	server.Authorize = func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/tags", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	request := httptest.NewRequest("GET", "/tags", nil)
+	request.Header.Set("Accept", "text/event-stream")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	request = httptest.NewRequest("GET", "/tags", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestStreamProvider_eventWithoutID(t *testing.T) {
+	lastEventIDs := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("id: \"v1\"\nevent: snapshot\ndata: {\"schemaVersion\":1,\"includedTags\":[\"tag-1\"]}\n\n" +
+			"event: snapshot\ndata: {\"schemaVersion\":1,\"includedTags\":[\"tag-2\"]}\n\n"))
+	}))
+	defer server.Close()
+
+	ct := newTestInstance(t, "stream-without-id")
+	provider := NewStreamProvider(server.URL, ct)
+	connected := func() {}
+	assert.NotNil(t, provider.stream(context.Background(), connected))
+	assert.True(t, ct.IsActive("tag-2"))
+	assert.Equal(t, `"v1"`, provider.Poller.lastETag())
+
+	provider.stream(context.Background(), connected)
+	assert.Equal(t, []string{"", `"v1"`}, lastEventIDs)
+}
+
+func TestSnapshotServer_close(t *testing.T) {
+	source := newTestInstance(t, "snapshot-close", &Presets{"namespace": "SnapshotClose"})
+	source.Register([]interface{}{"tag-1"})
+	snapshots, err := NewSnapshotServer(source)
+	assert.Nil(t, err)
+	server := httptest.NewServer(snapshots)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	ended := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body)
+		close(ended)
+	}()
+
+	etag, _ := snapshots.current()
+	assert.Nil(t, snapshots.Close())
+	assert.Nil(t, snapshots.Close())
+	select {
+	case <-ended:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the stream is not ended by Close")
+	}
+	// the changes of the manager are not published any more
+	source.Override("tag-1", false)
+	time.Sleep(20 * time.Millisecond)
+	current, _ := snapshots.current()
+	assert.Equal(t, etag, current)
+	source.mu.Lock()
+	assert.Empty(t, source.watchers)
+	source.mu.Unlock()
+}
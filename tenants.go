@@ -0,0 +1,220 @@
+package codetags
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// TenantLoader loads the overrides of a tenant, they are applied on top of
+// the base manager of the Tenants.
+type TenantLoader interface {
+	LoadTenant(tenant string) ([]OverrideRecord, error)
+}
+
+// TenantLoaderFunc adapts a function to the TenantLoader interface.
+type TenantLoaderFunc func(tenant string) ([]OverrideRecord, error)
+
+// LoadTenant calls f(tenant).
+func (f TenantLoaderFunc) LoadTenant(tenant string) ([]OverrideRecord, error) {
+	return f(tenant)
+}
+
+// Tenants creates one manager per tenant on the first use. A tenant manager
+// is a child of the base manager holding the overrides of the tenant, every
+// other tag falls back to the base manager. When the estimated size of the
+// loaded tenants goes beyond maxBytes, the least recently used tenants are
+// evicted and loaded again on their next use. The overrides with a TTL of an
+// evicted tenant are reverted, also in the manager that a caller may still
+// hold.
+type Tenants struct {
+	base     *TagManager
+	loader   TenantLoader
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+}
+
+type tenantEntry struct {
+	tenant  string
+	ready   chan struct{}
+	manager *TagManager
+	err     error
+	size    int64
+	// accounted is set when size is added to the size of the Tenants
+	accounted bool
+}
+
+// tenantOverhead is the estimated size of a tenant manager without override,
+// overrideOverhead the one of an override beside its strings.
+const (
+	tenantOverhead   = 2048
+	overrideOverhead = 256
+)
+
+// tenantSize estimates the memory held by a tenant manager.
+func tenantSize(records []OverrideRecord) int64 {
+	size := int64(tenantOverhead)
+	for _, record := range records {
+		size += int64(overrideOverhead + len(record.Tag) + len(record.Author) + len(record.Reason))
+	}
+	return size
+}
+
+// NewTenants creates the factory of the tenant managers, a maxBytes of 0
+// keeps every tenant. The most recently used tenant is always kept, even
+// when it is larger than maxBytes alone.
+func NewTenants(base *TagManager, loader TenantLoader, maxBytes int64) *Tenants {
+	return &Tenants{
+		base:     base,
+		loader:   loader,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get returns the manager of the tenant, it is loaded when the tenant is not
+// in memory. Concurrent calls for the same tenant share a single load. When
+// the loader panics, the panic goes on in the call running the load while
+// the calls waiting for it return an error; the next call loads the tenant
+// again.
+func (t *Tenants) Get(tenant string) (*TagManager, error) {
+	t.mu.Lock()
+	if elem, ok := t.entries[tenant]; ok {
+		t.lru.MoveToFront(elem)
+		t.mu.Unlock()
+		entry := elem.Value.(*tenantEntry)
+		<-entry.ready
+		return entry.manager, entry.err
+	}
+	entry := &tenantEntry{tenant: tenant, ready: make(chan struct{})}
+	elem := t.lru.PushFront(entry)
+	t.entries[tenant] = elem
+	t.mu.Unlock()
+
+	defer func() {
+		if entry.manager == nil && entry.err == nil {
+			// the loader panicked, the waiters must not block forever
+			entry.err = fmt.Errorf("The load of tenant [%s] panicked", tenant)
+		}
+		close(entry.ready)
+		t.loaded(elem)
+	}()
+	entry.manager, entry.size, entry.err = t.load(tenant)
+	return entry.manager, entry.err
+}
+
+// loaded accounts the size of a loaded tenant and evicts the least recently
+// used tenants beyond the budget, a failed load is evicted so that the next
+// call loads the tenant again.
+func (t *Tenants) loaded(elem *list.Element) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := elem.Value.(*tenantEntry)
+	if current, ok := t.entries[entry.tenant]; !ok || current != elem {
+		// evicted during the load
+		entry.revert()
+		return
+	}
+	if entry.err != nil {
+		t.evict(elem)
+		return
+	}
+	t.size += entry.size
+	entry.accounted = true
+	for t.maxBytes > 0 && t.size > t.maxBytes && t.lru.Back() != t.lru.Front() {
+		t.evict(t.lru.Back())
+	}
+}
+
+func (t *Tenants) load(tenant string) (*TagManager, int64, error) {
+	records, err := t.loader.LoadTenant(tenant)
+	if err != nil {
+		return nil, 0, err
+	}
+	c := newTagManager()
+	// a tenant decides with its overrides only, not with the environment
+	c.store.pinnedEnv[c.getLabel("includedTags")] = []string{}
+	c.store.pinnedEnv[c.getLabel("excludedTags")] = []string{}
+	c.clearCache()
+	if err := c.SetParent(t.base); err != nil {
+		return nil, 0, err
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	for _, record := range records {
+		c.applyOverride(record)
+	}
+	return c, tenantSize(records), nil
+}
+
+// IsActive evaluates the tag expressions for the tenant. When the tenant
+// could not be loaded, the base manager evaluates them.
+func (t *Tenants) IsActive(tenant string, tagexps ...interface{}) bool {
+	c, err := t.Get(tenant)
+	if err != nil {
+		t.base.mu.Lock()
+		t.base.warn("codetags: tenant is not loaded", "tenant", tenant, "error", err)
+		t.base.unlock()
+		return t.base.IsActive(tagexps...)
+	}
+	return c.IsActive(tagexps...)
+}
+
+// Evict drops the tenant from memory, it returns false when the tenant is
+// not loaded.
+func (t *Tenants) Evict(tenant string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elem, ok := t.entries[tenant]
+	if !ok {
+		return false
+	}
+	t.evict(elem)
+	return true
+}
+
+// Loaded returns the tenants in memory, the most recently used first.
+func (t *Tenants) Loaded() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenants := make([]string, 0, t.lru.Len())
+	for elem := t.lru.Front(); elem != nil; elem = elem.Next() {
+		tenants = append(tenants, elem.Value.(*tenantEntry).tenant)
+	}
+	return tenants
+}
+
+// evict drops the entry, the TTL overrides of a loaded tenant are reverted;
+// the ones of a pending load are reverted by loaded.
+func (t *Tenants) evict(elem *list.Element) {
+	entry := t.lru.Remove(elem).(*tenantEntry)
+	delete(t.entries, entry.tenant)
+	if entry.accounted {
+		t.size -= entry.size
+	}
+	select {
+	case <-entry.ready:
+		entry.revert()
+	default:
+	}
+}
+
+// revert reverts the TTL overrides of a loaded tenant, their timers would
+// keep the evicted manager in memory until they expire.
+func (e *tenantEntry) revert() {
+	if e.manager == nil {
+		return
+	}
+	e.manager.mu.Lock()
+	defer e.manager.unlock()
+	for tag, o := range e.manager.store.overrides {
+		if o.timer != nil {
+			e.manager.removeOverride(tag)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package codetags
+
+import "errors"
+import "os"
+import "sync"
+import "sync/atomic"
+import "time"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestTenants(t *testing.T) {
+	os.Setenv("TENANTS_INCLUDED_TAGS", "tag-2")
+	// the tenants do not read the environment of the default namespace
+	t.Setenv("CODETAGS_EXCLUDED_TAGS", "tag-1")
+
+	base := newTestInstance(t, "tenants", &Presets{"namespace": "Tenants"})
+	base.Register([]interface{}{"tag-1"})
+	loads := map[string]int{}
+	tenants := NewTenants(base, TenantLoaderFunc(func(tenant string) ([]OverrideRecord, error) {
+		loads[tenant]++
+		switch tenant {
+		case "acme":
+			return []OverrideRecord{{Tag: "tag-1", Enabled: false}, {Tag: "tag-3", Enabled: true}}, nil
+		case "broken":
+			return nil, errors.New("unavailable")
+		}
+		return nil, nil
+	}), 2*tenantOverhead+600)
+
+	assert.Empty(t, tenants.Loaded())
+	assert.False(t, tenants.IsActive("acme", "tag-1"))
+	assert.True(t, tenants.IsActive("acme", "tag-2"))
+	assert.True(t, tenants.IsActive("acme", "tag-3"))
+	assert.True(t, tenants.IsActive("globex", "tag-1"))
+	assert.False(t, tenants.IsActive("globex", "tag-3"))
+	assert.Equal(t, []string{"globex", "acme"}, tenants.Loaded())
+	assert.Equal(t, map[string]int{"acme": 1, "globex": 1}, loads)
+
+	// the base changes are seen by the loaded tenants
+	base.Override("tag-2", false)
+	assert.False(t, tenants.IsActive("globex", "tag-2"))
+
+	// acme is the least recently used tenant
+	tenants.IsActive("initech", "tag-1")
+	assert.Equal(t, []string{"initech", "globex"}, tenants.Loaded())
+	tenants.IsActive("acme", "tag-1")
+	assert.Equal(t, 2, loads["acme"])
+
+	assert.True(t, tenants.Evict("acme"))
+	assert.False(t, tenants.Evict("acme"))
+
+	// a tenant which is not loaded is evaluated by the base
+	assert.True(t, tenants.IsActive("broken", "tag-1"))
+	assert.True(t, tenants.IsActive("broken", "tag-1"))
+	assert.Equal(t, 2, loads["broken"])
+	assert.NotContains(t, tenants.Loaded(), "broken")
+}
+
+func TestTenants_concurrent(t *testing.T) {
+	base := newTestInstance(t, "tenants-concurrent")
+	var loads int32
+	tenants := NewTenants(base, TenantLoaderFunc(func(tenant string) ([]OverrideRecord, error) {
+		atomic.AddInt32(&loads, 1)
+		return []OverrideRecord{{Tag: tenant, Enabled: true}}, nil
+	}), 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, tenants.IsActive("acme", "acme"))
+			assert.False(t, tenants.IsActive("acme", "globex"))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestTenants_evict(t *testing.T) {
+	base := newTestInstance(t, "tenants-evict")
+	tenants := NewTenants(base, TenantLoaderFunc(func(tenant string) ([]OverrideRecord, error) {
+		return []OverrideRecord{
+			{Tag: "tag-1", Enabled: true, ExpiresAt: time.Now().Add(time.Hour)},
+			{Tag: "tag-2", Enabled: true},
+		}, nil
+	}), 0)
+
+	acme, err := tenants.Get("acme")
+	assert.Nil(t, err)
+	assert.True(t, acme.IsActive("tag-1"))
+	assert.True(t, tenants.Evict("acme"))
+	// the TTL overrides of an evicted tenant are reverted in the held manager
+	assert.Equal(t, map[string]bool{"tag-2": true}, acme.Overrides())
+	assert.False(t, acme.IsActive("tag-1"))
+	assert.Equal(t, int64(0), tenants.size)
+}
+
+func TestTenants_loaderPanic(t *testing.T) {
+	base := newTestInstance(t, "tenants-panic")
+	panicked := false
+	tenants := NewTenants(base, TenantLoaderFunc(func(tenant string) ([]OverrideRecord, error) {
+		if !panicked {
+			panicked = true
+			panic("boom")
+		}
+		return nil, nil
+	}), 0)
+
+	assert.Panics(t, func() {
+		tenants.Get("acme")
+	})
+	assert.Empty(t, tenants.Loaded())
+	_, err := tenants.Get("acme")
+	assert.Nil(t, err)
+}
+
+func TestTenants_loaderPanicWaiters(t *testing.T) {
+	base := newTestInstance(t, "tenants-panic-waiters")
+	started, release := make(chan struct{}), make(chan struct{})
+	var loads int32
+	tenants := NewTenants(base, TenantLoaderFunc(func(tenant string) ([]OverrideRecord, error) {
+		if atomic.AddInt32(&loads, 1) > 1 {
+			return nil, nil
+		}
+		close(started)
+		<-release
+		panic("boom")
+	}), 0)
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() {
+			panicked <- recover()
+		}()
+		tenants.Get("acme")
+	}()
+	<-started
+	waited := make(chan error)
+	go func() {
+		_, err := tenants.Get("acme")
+		waited <- err
+	}()
+	// the waiter shares the pending load
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	// the load re-raises the panic and the waiter gets an error
+	assert.Equal(t, "boom", <-panicked)
+	assert.EqualError(t, <-waited, "The load of tenant [acme] panicked")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	assert.Empty(t, tenants.Loaded())
+}
@@ -0,0 +1,180 @@
+package codetags
+
+import (
+	"errors"
+	"strings"
+)
+import "github.com/blang/semver"
+
+// Expr is a type-safe tag expression, built with Tag, All, Any and Not.
+type Expr interface {
+	evaluate(c *TagManager) bool
+	String() string
+}
+
+type tagExpr string
+
+type allExpr []Expr
+
+type anyExpr []Expr
+
+type notExpr struct {
+	expr Expr
+}
+
+// Tag is satisfied when the tag is activated.
+func Tag(name string) Expr {
+	return tagExpr(name)
+}
+
+// All is satisfied when every sub-expression is satisfied.
+func All(exprs ...Expr) Expr {
+	return allExpr(exprs)
+}
+
+// Any is satisfied when at least one sub-expression is satisfied.
+func Any(exprs ...Expr) Expr {
+	return anyExpr(exprs)
+}
+
+// Not is satisfied when the sub-expression is not satisfied.
+func Not(expr Expr) Expr {
+	return notExpr{expr}
+}
+
+func (e tagExpr) evaluate(c *TagManager) bool {
+	return c.checkLabelActivated(string(e))
+}
+
+func (e tagExpr) String() string {
+	return string(e)
+}
+
+func (e allExpr) evaluate(c *TagManager) bool {
+	for _, subexp := range e {
+		if !c.eval(subexp) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e allExpr) String() string {
+	return joinExprs(e, " && ")
+}
+
+func (e anyExpr) evaluate(c *TagManager) bool {
+	for _, subexp := range e {
+		if c.eval(subexp) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e anyExpr) String() string {
+	return joinExprs(e, " || ")
+}
+
+func (e notExpr) evaluate(c *TagManager) bool {
+	return !c.eval(e.expr)
+}
+
+func (e notExpr) String() string {
+	if _, ok := e.expr.(tagExpr); ok {
+		return "!" + e.expr.String()
+	}
+	return "!(" + e.expr.String() + ")"
+}
+
+func joinExprs(exprs []Expr, op string) string {
+	strs := make([]string, len(exprs))
+	for i, subexp := range exprs {
+		strs[i] = subexp.String()
+		switch group := subexp.(type) {
+		case allExpr:
+			if len(group) > 1 {
+				strs[i] = "(" + strs[i] + ")"
+			}
+		case anyExpr:
+			if len(group) > 1 {
+				strs[i] = "(" + strs[i] + ")"
+			}
+		}
+	}
+	return strings.Join(strs, op)
+}
+
+// Eval reports whether the expression is satisfied, a nil expression is never satisfied.
+func (c *TagManager) Eval(expr Expr) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.eval(expr)
+}
+
+func (c *TagManager) eval(expr Expr) bool {
+	if expr == nil {
+		return false
+	}
+	return expr.evaluate(c)
+}
+
+// Descriptor is the type-safe counterpart of TagDescriptor.
+type Descriptor struct {
+	Name    string
+	Enabled *bool
+	Plan    *Plan
+	Note    string
+}
+
+// Plan is the type-safe counterpart of TagPlan, a zero version means the
+// bound is not set.
+type Plan struct {
+	Enabled  bool
+	MinBound semver.Version
+	MaxBound semver.Version
+}
+
+// Bool returns a pointer to the value, a shorthand for Descriptor.Enabled.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// RegisterDescriptors declares the tags like Register does, but reports the
+// invalid descriptors as an error instead of panicking.
+func (c *TagManager) RegisterDescriptors(descriptors ...Descriptor) error {
+	c.mu.Lock()
+	defer c.unlock()
+	defs := make([]interface{}, 0, len(descriptors))
+	errs := []string{}
+	for _, descriptor := range descriptors {
+		if len(descriptor.Name) == 0 {
+			errs = append(errs, "The name of a descriptor must be not empty")
+			continue
+		}
+		defs = append(defs, descriptor.toTagDescriptor())
+	}
+	errs = append(errs, c.register(defs)...)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (d Descriptor) toTagDescriptor() TagDescriptor {
+	info := TagDescriptor{Name: d.Name, Note: d.Note}
+	if d.Enabled != nil {
+		info.Enabled = *d.Enabled
+	}
+	if d.Plan != nil {
+		plan := TagPlan{Enabled: d.Plan.Enabled}
+		if !d.Plan.MinBound.Equals(semver.Version{}) {
+			plan.MinBound = d.Plan.MinBound.String()
+		}
+		if !d.Plan.MaxBound.Equals(semver.Version{}) {
+			plan.MaxBound = d.Plan.MaxBound.String()
+		}
+		info.Plan = plan
+	}
+	return info
+}
@@ -0,0 +1,82 @@
+package codetags
+
+import "os"
+import "testing"
+import "github.com/blang/semver"
+import "github.com/stretchr/testify/assert"
+
+func TestRegisterDescriptors(t *testing.T) {
+	ct := newTestInstance(t, "typed-register", &Presets{"version": "0.1.7"})
+
+	err := ct.RegisterDescriptors(
+		Descriptor{Name: "feature-1"},
+		Descriptor{Name: "feature-2", Enabled: Bool(false)},
+		Descriptor{Name: "feature-3", Plan: &Plan{Enabled: true, MinBound: semver.MustParse("0.1.2")}},
+		Descriptor{Name: "feature-4", Plan: &Plan{Enabled: true, MinBound: semver.MustParse("0.1.8")}},
+		Descriptor{Name: "feature-5", Plan: &Plan{Enabled: false, MaxBound: semver.MustParse("0.1.6")}},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"feature-1", "feature-3", "feature-5"}, ct.GetDeclaredTags())
+}
+
+func TestRegisterDescriptors_invalid(t *testing.T) {
+	ct := newTestInstance(t, "typed-invalid")
+
+	err := ct.RegisterDescriptors(
+		Descriptor{Name: "feature-1"},
+		Descriptor{},
+		Descriptor{Name: "feature-1"},
+	)
+	assert.EqualError(t, err, "The name of a descriptor must be not empty\nTag [feature-1] is declared more than one time")
+	assert.Equal(t, []string{"feature-1"}, ct.GetDeclaredTags())
+}
+
+func TestEval(t *testing.T) {
+	os.Setenv("TYPEDEVAL_INCLUDED_TAGS", "abc")
+	os.Setenv("TYPEDEVAL_EXCLUDED_TAGS", "tag-2")
+
+	ct := newTestInstance(t, "typed-eval", &Presets{"namespace": "TypedEval"})
+	assert.Nil(t, ct.RegisterDescriptors(Descriptor{Name: "tag-1"}, Descriptor{Name: "tag-2"}))
+
+	assert.True(t, ct.Eval(Tag("abc")))
+	assert.True(t, ct.Eval(All(Tag("abc"), Tag("tag-1"))))
+	assert.True(t, ct.Eval(Any(Tag("tag-2"), Tag("tag-1"))))
+	assert.True(t, ct.Eval(Not(Tag("tag-2"))))
+	assert.True(t, ct.Eval(All()))
+	assert.False(t, ct.Eval(nil))
+	assert.False(t, ct.Eval(Any()))
+	assert.False(t, ct.Eval(All(Tag("abc"), Tag("tag-2"))))
+	assert.False(t, ct.Eval(Not(Any(Tag("tag-3"), Tag("tag-1")))))
+}
+
+func TestIsActive_expr(t *testing.T) {
+	os.Setenv("TYPEDACTIVE_INCLUDED_TAGS", "abc")
+	os.Setenv("TYPEDACTIVE_EXCLUDED_TAGS", "tag-2")
+
+	ct := newTestInstance(t, "typed-active", &Presets{"namespace": "TypedActive"})
+	assert.Nil(t, ct.RegisterDescriptors(Descriptor{Name: "tag-1"}, Descriptor{Name: "tag-2"}))
+
+	assert.True(t, ct.IsActive(Tag("abc")))
+	assert.True(t, ct.IsActive(All(Tag("abc"), Tag("tag-1"))))
+	assert.True(t, ct.IsActive(Any(Tag("tag-2"), Tag("tag-1"))))
+	assert.True(t, ct.IsActive(Not(Tag("tag-2"))))
+	assert.True(t, ct.IsActive(Tag("tag-2"), Tag("tag-1")))
+	assert.True(t, ct.IsActive([]interface{}{"abc", Not(Tag("tag-2"))}))
+	assert.False(t, ct.IsActive(Tag("tag-2")))
+	assert.False(t, ct.IsActive(All(Tag("abc"), Tag("tag-2"))))
+	assert.False(t, ct.IsActive(Any(Tag("tag-3"), Tag("tag-2"))))
+	assert.False(t, ct.IsActive(Not(Tag("tag-1"))))
+}
+
+func TestExpr_String(t *testing.T) {
+	expr := All(Tag("abc"), Not(Any(Tag("def"), Tag("xyz"))), Not(Tag("tag-1")))
+	assert.Equal(t, "abc && !(def || xyz) && !tag-1", expr.String())
+
+	parsed, err := ParseExpression(expr.String())
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		"abc",
+		map[string]interface{}{"$not": map[string]interface{}{"$any": []interface{}{"def", "xyz"}}},
+		map[string]interface{}{"$not": "tag-1"},
+	}, parsed)
+}
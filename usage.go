@@ -0,0 +1,126 @@
+package codetags
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type tagUsage struct {
+	count    uint64
+	last     time.Time
+	period   uint64
+	everTrue bool
+}
+
+// maxUndeclaredUsage bounds the number of undeclared tags in the usage
+// statistics, dynamic tag names would make them grow without limit.
+const maxUndeclaredUsage = 1000
+
+// TagUsage describes how often a tag has been evaluated. LastEvaluated is
+// taken on the first evaluation after the previous report, not on each one,
+// so its precision is the interval between the reports.
+type TagUsage struct {
+	Name          string    `json:"name"`
+	Declared      bool      `json:"declared"`
+	Count         uint64    `json:"count"`
+	LastEvaluated time.Time `json:"lastEvaluated"`
+	EverTrue      bool      `json:"everTrue"`
+}
+
+// UsageReport lists the usage of every declared tag, in declaration order,
+// and of the tags that have been evaluated without being declared; up to
+// 1000 of them are tracked.
+type UsageReport struct {
+	Declared   []TagUsage `json:"declared"`
+	Undeclared []TagUsage `json:"undeclared"`
+}
+
+func (c *TagManager) recordUsage(label string, result bool) {
+	usage, ok := c.store.usage[label]
+	if !ok {
+		if !listContains(c.store.declaredTags, label) &&
+			len(c.store.usage) >= len(c.store.declaredTags)+maxUndeclaredUsage {
+			return
+		}
+		usage = &tagUsage{}
+		c.store.usage[label] = usage
+	}
+	usage.count++
+	// IsActive is the hot path, the clock is read once per report
+	if usage.last.IsZero() || usage.period != c.store.usagePeriod {
+		usage.last = time.Now()
+		usage.period = c.store.usagePeriod
+	}
+	usage.everTrue = usage.everTrue || result
+}
+
+// GetUsageReport returns the evaluation statistics since the manager was
+// created or reset; ClearCache keeps them.
+func (c *TagManager) GetUsageReport() UsageReport {
+	c.mu.Lock()
+	defer c.unlock()
+	c.store.usagePeriod++
+	report := UsageReport{
+		Declared:   make([]TagUsage, 0, len(c.store.declaredTags)),
+		Undeclared: make([]TagUsage, 0),
+	}
+	for _, tag := range c.store.declaredTags {
+		report.Declared = append(report.Declared, c.getTagUsage(tag, true))
+	}
+	for tag := range c.store.usage {
+		if !listContains(c.store.declaredTags, tag) {
+			report.Undeclared = append(report.Undeclared, c.getTagUsage(tag, false))
+		}
+	}
+	sort.Slice(report.Undeclared, func(i, j int) bool {
+		return report.Undeclared[i].Name < report.Undeclared[j].Name
+	})
+	return report
+}
+
+func (c *TagManager) getTagUsage(tag string, declared bool) TagUsage {
+	info := TagUsage{Name: tag, Declared: declared}
+	if usage, ok := c.store.usage[tag]; ok {
+		info.Count = usage.count
+		info.LastEvaluated = usage.last
+		info.EverTrue = usage.everTrue
+	}
+	return info
+}
+
+// NeverEvaluated returns the declared tags which have not been evaluated,
+// they are the candidates for a cleanup.
+func (r UsageReport) NeverEvaluated() []string {
+	tags := make([]string, 0)
+	for _, usage := range r.Declared {
+		if usage.Count == 0 {
+			tags = append(tags, usage.Name)
+		}
+	}
+	return tags
+}
+
+// ReportUsage invokes fn with a fresh usage report every interval until the
+// returned stop function is called.
+func (c *TagManager) ReportUsage(interval time.Duration, fn func(UsageReport)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				fn(c.GetUsageReport())
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package codetags
+
+import "os"
+import "strconv"
+import "testing"
+import "time"
+import "github.com/stretchr/testify/assert"
+
+func TestGetUsageReport(t *testing.T) {
+	os.Setenv("USAGE_INCLUDED_TAGS", "abc")
+	os.Setenv("USAGE_EXCLUDED_TAGS", "tag-2")
+
+	ct := newTestInstance(t, "usage", &Presets{"namespace": "Usage"})
+	ct.Register([]interface{}{"tag-1", "tag-2", "tag-3"})
+
+	before := time.Now()
+	ct.IsActive("tag-1")
+	ct.IsActive("tag-1")
+	ct.IsActive("tag-2")
+	ct.ClearCache()
+	ct.IsActive("xyz", "abc")
+
+	report := ct.GetUsageReport()
+	assert.Equal(t, 3, len(report.Declared))
+	assert.Equal(t, "tag-1", report.Declared[0].Name)
+	assert.Equal(t, uint64(2), report.Declared[0].Count)
+	assert.True(t, report.Declared[0].EverTrue)
+	assert.False(t, report.Declared[0].LastEvaluated.Before(before))
+	assert.Equal(t, uint64(1), report.Declared[1].Count)
+	assert.False(t, report.Declared[1].EverTrue)
+	assert.True(t, report.Declared[2].LastEvaluated.IsZero())
+	assert.Equal(t, []string{"tag-3"}, report.NeverEvaluated())
+
+	assert.Equal(t, []TagUsage{
+		{Name: "abc", Count: 1, LastEvaluated: report.Undeclared[0].LastEvaluated, EverTrue: true},
+		{Name: "xyz", Count: 1, LastEvaluated: report.Undeclared[1].LastEvaluated},
+	}, report.Undeclared)
+
+	ct.Reset()
+	assert.Empty(t, ct.GetUsageReport().Undeclared)
+}
+
+func TestReportUsage(t *testing.T) {
+	ct := newTestInstance(t, "usage-report")
+	ct.Register([]interface{}{"tag-1"})
+
+	reports := make(chan UsageReport, 1)
+	stop := ct.ReportUsage(time.Millisecond, func(report UsageReport) {
+		select {
+		case reports <- report:
+		default:
+		}
+	})
+	report := <-reports
+	stop()
+	stop()
+	assert.Equal(t, []string{"tag-1"}, report.NeverEvaluated())
+}
+
+func TestReportUsage_concurrent(t *testing.T) {
+	ct := newTagManager()
+	ct.Register([]interface{}{"tag-1"})
+
+	reports := make(chan UsageReport, 1)
+	stop := ct.ReportUsage(time.Millisecond, func(report UsageReport) {
+		select {
+		case reports <- report:
+		default:
+		}
+	})
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			ct.IsActive("tag-1")
+		}
+	}()
+	<-reports
+	<-done
+	assert.Equal(t, uint64(1000), ct.GetUsageReport().Declared[0].Count)
+}
+
+func TestGetUsageReport_undeclaredLimit(t *testing.T) {
+	ct := newTagManager()
+	for i := 0; i < maxUndeclaredUsage+10; i++ {
+		ct.IsActive("dynamic-" + strconv.Itoa(i))
+	}
+	ct.Register([]interface{}{"tag-1"})
+	ct.IsActive("tag-1")
+
+	report := ct.GetUsageReport()
+	assert.Equal(t, maxUndeclaredUsage, len(report.Undeclared))
+	assert.Equal(t, uint64(1), report.Declared[0].Count)
+}
+
+func TestGetUsageReport_lastEvaluated(t *testing.T) {
+	ct := newTagManager()
+	ct.Register([]interface{}{"tag-1"})
+
+	ct.IsActive("tag-1")
+	first := ct.GetUsageReport().Declared[0].LastEvaluated
+	assert.False(t, first.IsZero())
+
+	// the time is taken once per report
+	time.Sleep(2 * time.Millisecond)
+	ct.IsActive("tag-1")
+	ct.IsActive("tag-1")
+	report := ct.GetUsageReport()
+	assert.Equal(t, uint64(3), report.Declared[0].Count)
+	assert.True(t, report.Declared[0].LastEvaluated.After(first))
+	second := report.Declared[0].LastEvaluated
+
+	time.Sleep(2 * time.Millisecond)
+	ct.IsActive("tag-1")
+	time.Sleep(2 * time.Millisecond)
+	ct.IsActive("tag-1")
+	third := ct.GetUsageReport().Declared[0].LastEvaluated
+	assert.True(t, third.After(second))
+	assert.True(t, time.Since(third) >= 2*time.Millisecond)
+}
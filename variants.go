@@ -0,0 +1,184 @@
+package codetags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VariantDescriptor declares a multivariate tag. The value of the tag is the
+// value of the Default variant, unless the <NAMESPACE>_VARIANTS environment
+// variable picks another one, e.g. CODETAGS_VARIANTS=checkout=v2,timeout=30.
+// A tag missing from that list is picked by the <NAMESPACE>_VARIANTS_<NAME>
+// variable, e.g. CODETAGS_VARIANTS_LAYOUT={"columns":3}. A pick that is not
+// the name of a variant is used as a raw value, the whole variable of a tag
+// is the value so it may be any JSON document.
+type VariantDescriptor struct {
+	Name     string
+	Variants map[string]interface{}
+	Default  string
+	Note     string
+}
+
+// RegisterVariants declares the multivariate tags, they are activated like
+// the tags declared by Register.
+func (c *TagManager) RegisterVariants(descriptors ...VariantDescriptor) error {
+	c.mu.Lock()
+	defer c.unlock()
+	defs := make([]interface{}, 0, len(descriptors))
+	errs := []string{}
+	for _, descriptor := range descriptors {
+		if len(descriptor.Name) == 0 {
+			errs = append(errs, "The name of a descriptor must be not empty")
+			continue
+		}
+		if _, ok := descriptor.Variants[descriptor.Default]; !ok {
+			errs = append(errs, fmt.Sprintf("Tag [%s] has no default variant [%s]", descriptor.Name, descriptor.Default))
+			continue
+		}
+		if _, ok := c.store.variants[descriptor.Name]; !ok && !listContains(c.store.declaredTags, descriptor.Name) {
+			c.store.variants[descriptor.Name] = descriptor
+		}
+		defs = append(defs, TagDescriptor{Name: descriptor.Name, Note: descriptor.Note})
+	}
+	errs = append(errs, c.register(defs)...)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// GetVariant returns the name of the selected variant, or an empty string
+// when the tag is not active or the value is picked from the environment.
+func (c *TagManager) GetVariant(tag string) string {
+	c.mu.Lock()
+	defer c.unlock()
+	if !c.checkLabelActivated(tag) {
+		return ""
+	}
+	descriptor := c.store.variants[tag]
+	if pick, ok := c.variantPick(tag); ok {
+		if _, ok := descriptor.Variants[pick]; ok {
+			return pick
+		}
+		return ""
+	}
+	return descriptor.Default
+}
+
+func (c *TagManager) getVariantValue(tag string) (interface{}, bool) {
+	if !c.checkLabelActivated(tag) {
+		return nil, false
+	}
+	descriptor, declared := c.store.variants[tag]
+	if pick, ok := c.variantPick(tag); ok {
+		if val, ok := descriptor.Variants[pick]; ok {
+			return val, true
+		}
+		return pick, true
+	}
+	if !declared {
+		return nil, false
+	}
+	return descriptor.Variants[descriptor.Default], true
+}
+
+// GetString returns the value of a multivariate tag as a string, or the
+// fallback when the tag is not active or its value is not a string.
+func (c *TagManager) GetString(tag string, fallback string) string {
+	c.mu.Lock()
+	val, ok := c.getVariantValue(tag)
+	c.unlock()
+	if !ok {
+		return fallback
+	}
+	if str, ok := val.(string); ok {
+		return str
+	}
+	return fallback
+}
+
+// GetInt returns the value of a multivariate tag as an int, or the fallback
+// when the tag is not active or its value is not an integer.
+func (c *TagManager) GetInt(tag string, fallback int) int {
+	c.mu.Lock()
+	val, ok := c.getVariantValue(tag)
+	c.unlock()
+	if !ok {
+		return fallback
+	}
+	switch v := val.(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		if v == float64(int(v)) {
+			return int(v)
+		}
+	case string:
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+// GetJSON returns the decoded value of a multivariate tag whose variants are
+// JSON documents, or the fallback when the tag is not active or its value
+// could not be decoded.
+func (c *TagManager) GetJSON(tag string, fallback interface{}) interface{} {
+	c.mu.Lock()
+	val, ok := c.getVariantValue(tag)
+	c.unlock()
+	if !ok {
+		return fallback
+	}
+	var data []byte
+	switch v := val.(type) {
+	case json.RawMessage:
+		data = v
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return val
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fallback
+	}
+	return decoded
+}
+
+func parseVariantPicks(pairs []string) map[string]string {
+	picks := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		tag, pick := strings.Trim(kv[0], ` `), strings.Trim(kv[1], ` `)
+		if len(tag) > 0 && len(pick) > 0 {
+			picks[tag] = pick
+		}
+	}
+	return picks
+}
+
+// variantPick returns the pick of the tag in the <NAMESPACE>_VARIANTS list,
+// or reads its <NAMESPACE>_VARIANTS_<NAME> variable; the picks are cached
+// until the next refresh of the environment.
+func (c *TagManager) variantPick(tag string) (string, bool) {
+	pick, ok := c.store.variantPicks[tag]
+	if !ok {
+		pick = strings.TrimSpace(c.lookup(c.getLabel("variants") + "_" + labelify(tag)))
+		c.store.variantPicks[tag] = pick
+	}
+	return pick, len(pick) > 0
+}
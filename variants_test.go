@@ -0,0 +1,85 @@
+package codetags
+
+import "encoding/json"
+import "os"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestRegisterVariants(t *testing.T) {
+	os.Setenv("VARIANTS_VARIANTS", "checkout=v2, timeout= 30 ")
+	os.Setenv("VARIANTS_VARIANTS_CHECKOUT", "v1")
+	os.Setenv("VARIANTS_VARIANTS_LAYOUT", `{"a":1,"b":[2,3]}`)
+	os.Setenv("VARIANTS_EXCLUDED_TAGS", "banner")
+
+	ct := newTestInstance(t, "variants", &Presets{"namespace": "Variants"})
+	err := ct.RegisterVariants(
+		VariantDescriptor{
+			Name:     "checkout",
+			Variants: map[string]interface{}{"v1": "classic", "v2": "one-page"},
+			Default:  "v1",
+		},
+		VariantDescriptor{
+			Name:     "color",
+			Variants: map[string]interface{}{"control": "blue", "red": "red"},
+			Default:  "control",
+		},
+		VariantDescriptor{
+			Name:     "timeout",
+			Variants: map[string]interface{}{"short": 5, "long": 60},
+			Default:  "short",
+		},
+		VariantDescriptor{
+			Name:     "layout",
+			Variants: map[string]interface{}{"grid": json.RawMessage(`{"columns":3}`)},
+			Default:  "grid",
+		},
+		VariantDescriptor{
+			Name:     "banner",
+			Variants: map[string]interface{}{"on": "hello"},
+			Default:  "on",
+		},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"checkout", "color", "timeout", "layout", "banner"}, ct.GetDeclaredTags())
+
+	assert.Equal(t, "v2", ct.GetVariant("checkout"))
+	assert.Equal(t, "one-page", ct.GetString("checkout", "none"))
+	assert.Equal(t, "control", ct.GetVariant("color"))
+	assert.Equal(t, "blue", ct.GetString("color", "none"))
+	assert.Equal(t, 30, ct.GetInt("timeout", 10))
+	assert.Equal(t, 10, ct.GetInt("color", 10))
+	assert.Equal(t, 10, ct.GetInt("checkout", 10))
+	// a raw pick from the environment is a string value
+	assert.Equal(t, "30", ct.GetString("timeout", "none"))
+	assert.Equal(t, "none", ct.GetString("banner", "none"))
+	assert.Equal(t, "none", ct.GetString("undeclared", "none"))
+	// a JSON pick from the variable of the tag round-trips whatever it contains
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": []interface{}{float64(2), float64(3)}},
+		ct.GetJSON("layout", "fallback"))
+	assert.Equal(t, "", ct.GetVariant("layout"))
+	assert.True(t, ct.IsActive("checkout"))
+	assert.False(t, ct.IsActive("banner"))
+}
+
+func TestRegisterVariants_json(t *testing.T) {
+	ct := newTestInstance(t, "variants-json")
+	err := ct.RegisterVariants(VariantDescriptor{
+		Name:     "layout",
+		Variants: map[string]interface{}{"grid": json.RawMessage(`{"columns":3}`)},
+		Default:  "grid",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"columns": float64(3)}, ct.GetJSON("layout", nil))
+}
+
+func TestRegisterVariants_invalid(t *testing.T) {
+	ct := newTestInstance(t, "variants-invalid")
+	ct.Register([]interface{}{"color"})
+
+	err := ct.RegisterVariants(
+		VariantDescriptor{Name: "size", Variants: map[string]interface{}{"s": 1}, Default: "m"},
+		VariantDescriptor{Name: "color", Variants: map[string]interface{}{"red": "red"}, Default: "red"},
+	)
+	assert.EqualError(t, err, "Tag [size] has no default variant [m]\nTag [color] is declared more than one time")
+	assert.Equal(t, "", ct.GetString("color", ""))
+}